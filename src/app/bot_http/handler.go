@@ -1,8 +1,13 @@
 package bot_http
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
+	json "github.com/bytedance/sonic"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/thoas/go-funk"
 	"ns-rss/src/app"
 	"ns-rss/src/app/db"
@@ -22,12 +27,32 @@ func validateToken(writer http.ResponseWriter, request *http.Request) bool {
 	return v
 }
 
+var metricsHandler = promhttp.Handler()
+
+// httpHandlerMetrics prometheus 指标
+func httpHandlerMetrics(writer http.ResponseWriter, request *http.Request) {
+	metricsHandler.ServeHTTP(writer, request)
+}
+
+// writeError 返回错误信息
+func writeError(writer http.ResponseWriter, code int, msg string) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(code)
+	_, _ = writer.Write([]byte(app.ToJson(map[string]any{"code": code, "msg": msg})))
+}
+
 // RouteHandler 命令处理器映射
 var RouteHandler = map[string]BotHttpHandler{
-	"/ping":                httpHandlerPing,
-	"/api/feed":            httpHandlerFeed,
-	"/api/subscribe/trans": httpHandlerSubscribeTrans,
-	"/api/notice":          httpHandlerNotice,
+	"/ping":                 httpHandlerPing,
+	"/api/feed":             httpHandlerFeed,
+	"/api/feed/health":      httpHandlerFeedHealth,
+	"/api/subscribe/trans":  httpHandlerSubscribeTrans,
+	"/api/notice":           httpHandlerNotice,
+	"/api/test":             httpHandlerTest,
+	"/api/dead_letter":      httpHandlerDeadLetter,
+	"/api/webhook":          httpHandlerWebhook,
+	"/api/webhook/delivery": httpHandlerWebhookDelivery,
+	"/metrics":              httpHandlerMetrics,
 }
 
 func httpHandlerPing(writer http.ResponseWriter, request *http.Request) {
@@ -45,29 +70,336 @@ func httpHandlerFeed(writer http.ResponseWriter, request *http.Request) {
 		_, _ = writer.Write([]byte(app.ToJson(feeds)))
 		return
 	}
+	if request.Method == "DELETE" {
+		feedId := request.URL.Query().Get("feed_id")
+		if feedId == "" {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := lib.DeleteFeed(feedId); err != nil {
+			writeError(writer, http.StatusBadRequest, err.Error())
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"code":1000,"msg":"success"}`))
+		return
+	}
 
 	if err := request.ParseForm(); err != nil {
 		writer.WriteHeader(http.StatusBadRequest)
 		return
 	}
 	feedId := request.FormValue("feed_id")
-	feedUrl := request.FormValue("feed_url")
-	feedName := request.FormValue("feed_name")
-	if feedId == "" || feedUrl == "" {
+	if feedId == "" {
 		writer.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	db.AddOrUpdateFeed(db.FeedConfig{
-		Name:    feedName,
-		FeedUrl: feedUrl,
-		FeedId:  feedId,
-	})
+	// 只更新请求中携带的字段, 传空值可以恢复默认设置
+	feed := db.GetFeedConfigWithFeedId(feedId)
+	feed.FeedId = feedId
+	fields := map[string]*string{
+		"feed_url":     &feed.FeedUrl,
+		"feed_name":    &feed.Name,
+		"min_interval": &feed.MinInterval,
+		"max_interval": &feed.MaxInterval,
+		"timeout":      &feed.Timeout,
+		"cookies":      &feed.Cookies,
+		"proxy":        &feed.Proxy,
+		"impersonate":  &feed.Impersonate,
+		"template":     &feed.Template,
+	}
+	for key, field := range fields {
+		if _, ok := request.Form[key]; ok {
+			*field = strings.TrimSpace(request.FormValue(key))
+		}
+	}
+	if _, ok := request.Form["paused"]; ok {
+		paused, err := strconv.ParseBool(request.FormValue("paused"))
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "paused 只支持 true、false")
+			return
+		}
+		feed.Paused = paused
+	}
+	if _, ok := request.Form["headers"]; ok {
+		feed.HeadersMap = nil
+		if headers := strings.TrimSpace(request.FormValue("headers")); headers != "" {
+			if err := json.Unmarshal([]byte(headers), &feed.HeadersMap); err != nil {
+				writeError(writer, http.StatusBadRequest, "headers 需要是 JSON 对象, 例如: {\"Referer\":\"https://www.nodeseek.com\"}")
+				return
+			}
+		}
+	}
+
+	if err := lib.ValidateFeedConfig(feed); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := db.SaveFeedConfig(feed); err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	lib.FeedRegistryInstance().Reload()
 
 	writer.Header().Set("Content-Type", "application/json")
 	_, _ = writer.Write([]byte(`{"code":1000,"msg":"success"}`))
 }
 
+type feedHealthItem struct {
+	db.FeedState
+	Name   string `json:"name"`
+	Paused bool   `json:"paused"`
+}
+
+// httpHandlerFeedHealth 查询各 feed 的抓取健康状态
+func httpHandlerFeedHealth(writer http.ResponseWriter, request *http.Request) {
+	if validateToken(writer, request) == false {
+		return
+	}
+	feeds := lib.FeedRegistryInstance().List()
+	items := make([]feedHealthItem, 0, len(feeds))
+	for _, feed := range feeds {
+		state, _ := lib.FeedHealthInstance().Get(feed.FeedId)
+		state.FeedUrl = feed.FeedUrl
+		items = append(items, feedHealthItem{FeedState: state, Name: feed.Name, Paused: feed.Paused})
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+		"code": 1000,
+		"msg":  "success",
+		"data": items,
+	})))
+}
+
+// httpHandlerDeadLetter GET 查询发送失败的消息, POST 重新发送
+func httpHandlerDeadLetter(writer http.ResponseWriter, request *http.Request) {
+	if validateToken(writer, request) == false {
+		return
+	}
+	if request.Method == "GET" {
+		all, _ := strconv.ParseBool(request.URL.Query().Get("all"))
+		limit, err := strconv.Atoi(request.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 500 {
+			limit = 100
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+			"code": 1000,
+			"msg":  "success",
+			"data": db.ListDeadLetters(all, limit),
+		})))
+		return
+	}
+	if request.Method != "POST" {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// id 多个用逗号分隔, 不传时重新发送所有未处理的消息
+	ids, err := parseIds(request.FormValue("id"))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	n, err := lib.ReplayDeadLetters(ids)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+		"code": 1000,
+		"msg":  "success",
+		"data": map[string]any{"replayed": n},
+	})))
+}
+
+// parseIds 解析逗号分隔的 id
+func parseIds(s string) ([]uint, error) {
+	var ids []uint
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, errors.New("id 格式错误: " + v)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// httpHandlerWebhook GET 查询 webhook, POST 添加或修改, DELETE 删除
+func httpHandlerWebhook(writer http.ResponseWriter, request *http.Request) {
+	if validateToken(writer, request) == false {
+		return
+	}
+	switch request.Method {
+	case "GET":
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+			"code": 1000,
+			"msg":  "success",
+			"data": db.ListWebhooks(),
+		})))
+		return
+	case "DELETE":
+		id, err := strconv.ParseUint(request.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "id 格式错误")
+			return
+		}
+		n, err := db.DeleteWebhook(uint(id))
+		if err != nil {
+			writeError(writer, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if n == 0 {
+			writeError(writer, http.StatusNotFound, "未找到该webhook")
+			return
+		}
+		lib.WebhookRegistryInstance().Invalidate()
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(`{"code":1000,"msg":"success"}`))
+		return
+	case "POST":
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := request.ParseForm(); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// 传 id 时修改已有的 webhook, 只更新请求中携带的字段
+	w := &db.Webhook{Enabled: true}
+	if v := request.FormValue("id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "id 格式错误")
+			return
+		}
+		if w = db.GetWebhook(uint(id)); w == nil {
+			writeError(writer, http.StatusNotFound, "未找到该webhook")
+			return
+		}
+	}
+	if _, ok := request.Form["feed_id"]; ok {
+		w.FeedId = strings.TrimSpace(request.FormValue("feed_id"))
+	}
+	if _, ok := request.Form["url"]; ok {
+		w.Url = strings.TrimSpace(request.FormValue("url"))
+	}
+	if _, ok := request.Form["secret"]; ok {
+		w.Secret = strings.TrimSpace(request.FormValue("secret"))
+	}
+	// 每个 keyword 参数是一条关键字规则, 语法与 /add 相同
+	if keywords, ok := request.Form["keyword"]; ok {
+		w.KeywordsArray = nil
+		for _, keyword := range keywords {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				w.KeywordsArray = append(w.KeywordsArray, keyword)
+			}
+		}
+		// 因正则超时自动停用的 webhook 修改关键字后重新启用
+		if w.DisabledReason == db.WebhookDisabledRegexTimeout {
+			w.Enabled = true
+			w.DisabledReason = ""
+		}
+	}
+	if _, ok := request.Form["enabled"]; ok {
+		enabled, err := strconv.ParseBool(request.FormValue("enabled"))
+		if err != nil {
+			writeError(writer, http.StatusBadRequest, "enabled 只支持 true、false")
+			return
+		}
+		w.Enabled = enabled
+		w.DisabledReason = ""
+		if !enabled {
+			w.DisabledReason = db.WebhookDisabledManual
+		}
+	}
+	if w.Secret == "" {
+		w.Secret = lib.NewWebhookSecret()
+	}
+
+	if err := lib.ValidateWebhook(w); err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := db.SaveWebhook(w); err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	lib.WebhookRegistryInstance().Invalidate()
+
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+		"code": 1000,
+		"msg":  "success",
+		"data": map[string]any{"id": w.ID, "secret": w.Secret},
+	})))
+}
+
+// httpHandlerWebhookDelivery GET 查询投递记录, POST 重新投递失败的记录
+func httpHandlerWebhookDelivery(writer http.ResponseWriter, request *http.Request) {
+	if validateToken(writer, request) == false {
+		return
+	}
+	if request.Method == "GET" {
+		query := request.URL.Query()
+		webhookId, _ := strconv.ParseUint(query.Get("webhook_id"), 10, 64)
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > 500 {
+			limit = 100
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+			"code": 1000,
+			"msg":  "success",
+			"data": db.ListWebhookDeliveries(uint(webhookId), query.Get("status"), limit),
+		})))
+		return
+	}
+	if request.Method != "POST" {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ids, err := parseIds(request.FormValue("id"))
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(ids) == 0 {
+		writeError(writer, http.StatusBadRequest, "id 不能为空")
+		return
+	}
+	n, err := db.RedeliverWebhookDeliveries(ids)
+	if err != nil {
+		writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+		"code": 1000,
+		"msg":  "success",
+		"data": map[string]any{"redelivered": n},
+	})))
+}
+
 func httpHandlerSubscribeTrans(writer http.ResponseWriter, request *http.Request) {
 	// 转换订阅数据
 	//查询所有订阅者
@@ -86,6 +418,9 @@ func httpHandlerSubscribeTrans(writer http.ResponseWriter, request *http.Request
 		})
 
 	}
+	// 转换来的关键字按升级前的语法保存, 需要检查新旧语法的含义是否一致
+	lib.MigrateStoredKeywords()
+	lib.MatcherRegistryInstance().InvalidateAll()
 }
 
 func httpHandlerNotice(writer http.ResponseWriter, request *http.Request) {
@@ -113,9 +448,57 @@ func httpHandlerNotice(writer http.ResponseWriter, request *http.Request) {
 		return c.Status == "on"
 	}).([]*db.Subscribe)
 	for _, sub := range subs {
-		app.GetBotInstance().Notify(lib.NotifyMessage{Text: text, ChatId: &sub.ChatId})
+		msg := lib.NotifyMessage{Text: text, ChatId: &sub.ChatId, MsgType: sub.Type}
+		// 抓取服务运行时经发件箱发送, 受频率限制并停用屏蔽了机器人的订阅者
+		if f := lib.NsFeedInstance(); f != nil {
+			f.Add(msg)
+			continue
+		}
+		app.GetBotInstance().Notify(msg)
 	}
 
 	writer.Header().Set("Content-Type", "application/json")
 	_, _ = writer.Write([]byte(`{"code":1000,"msg":"success"}`))
 }
+
+type testItem struct {
+	Title     string `json:"title"`
+	Link      string `json:"link"`
+	Published string `json:"published"`
+}
+
+// httpHandlerTest 使用最近抓取的帖子试运行关键字
+func httpHandlerTest(writer http.ResponseWriter, request *http.Request) {
+	if validateToken(writer, request) == false {
+		return
+	}
+	if err := request.ParseForm(); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	feedId := request.FormValue("feed_id")
+	keyword := request.FormValue("keyword")
+	if feedId == "" || keyword == "" {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	matched, total, err := lib.TestKeyword(feedId, keyword)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	items := make([]testItem, 0, len(matched))
+	for _, item := range matched {
+		items = append(items, testItem{Title: item.Title, Link: item.Link, Published: item.Published})
+	}
+	_, _ = writer.Write([]byte(app.ToJson(map[string]any{
+		"code":  1000,
+		"msg":   "success",
+		"total": total,
+		"data":  items,
+	})))
+}
@@ -25,14 +25,17 @@ type Subscribe struct {
 }
 
 type Config struct {
-	Port              string       `yaml:"port"`
-	TgToken           string       `yaml:"tgToken"`
-	NsFeed            string       `yaml:"nsFeed"`
-	AdminId           int64        `yaml:"adminId"`
-	FetchTimeInterval string       `yaml:"fetchTimeInterval"` //抓取rss时间间隔
-	Subscribes        []*Subscribe `yaml:"channels"`
-	AccessKey         string       `yaml:"accessKey"` //访问密钥
-	Online            bool         `yaml:"online"`
+	Port                 string       `yaml:"port"`
+	TgToken              string       `yaml:"tgToken"`
+	NsFeed               string       `yaml:"nsFeed"`
+	AdminId              int64        `yaml:"adminId"`
+	FetchTimeInterval    string       `yaml:"fetchTimeInterval"` //抓取rss时间间隔
+	Subscribes           []*Subscribe `yaml:"channels"`
+	AccessKey            string       `yaml:"accessKey"` //访问密钥
+	Online               bool         `yaml:"online"`
+	FeedItemRetention    string       `yaml:"feedItemRetention"`    //抓取条目保留时长, 默认168h, 0为不按时间清理
+	FeedItemMaxPerFeed   int          `yaml:"feedItemMaxPerFeed"`   //每个rss源最多保留的条目数, 默认5000, 负数为不限制
+	FeedFailureThreshold int          `yaml:"feedFailureThreshold"` //rss源连续抓取失败多少次后通知管理员, 默认5
 }
 
 func (c *Config) Storage(path string) {
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeadLetter 多次重试或永久失败后无法发送的消息, 管理员可以查看并重新发送
+type DeadLetter struct {
+	ID         uint       `gorm:"primaryKey,autoIncrement" json:"id"`
+	OutboxId   uint       `gorm:"index" json:"outboxId"`
+	ChatId     int64      `gorm:"not null;index" json:"chatId"`
+	TargetId   uint       `gorm:"not null;default:0" json:"targetId"`
+	Title      string     `json:"title"`
+	Url        string     `json:"url"`
+	Text       string     `gorm:"not null" json:"text"`
+	MsgType    string     `json:"msgType"`
+	Silent     bool       `gorm:"not null;default:false" json:"silent"`
+	Attempts   int        `json:"attempts"`
+	Reason     string     `json:"reason"`
+	Permanent  bool       `gorm:"not null;default:false" json:"permanent"` // 永久错误, 重试也无法成功
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	ReplayedAt *time.Time `json:"replayedAt"` // 重新发送的时间, 为空表示未处理
+}
+
+func (d DeadLetter) TableName() string {
+	return "dead_letter"
+}
+
+func newDeadLetter(o *Outbox, reason string, permanent bool) *DeadLetter {
+	return &DeadLetter{
+		OutboxId:  o.ID,
+		ChatId:    o.ChatId,
+		TargetId:  o.TargetId,
+		Title:     o.Title,
+		Url:       o.Url,
+		Text:      o.Text,
+		MsgType:   o.MsgType,
+		Silent:    o.Silent,
+		Attempts:  o.Attempts,
+		Reason:    reason,
+		Permanent: permanent,
+	}
+}
+
+// MoveOutboxToDeadLetter 标记消息发送失败并写入死信表
+func MoveOutboxToDeadLetter(o *Outbox, reason string, permanent bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Outbox{}).Where("id = ?", o.ID).Updates(map[string]interface{}{
+			"status":     OutboxFailed,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"last_error": reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		d := newDeadLetter(o, reason, permanent)
+		d.Attempts++
+		return tx.Create(d).Error
+	})
+}
+
+// MoveChatOutboxToDeadLetter 将聊天所有待发送的 Telegram 消息写入死信表, 用于聊天已无法送达的情况
+func MoveChatOutboxToDeadLetter(chatId int64, reason string) (int64, error) {
+	var count int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var messages []*Outbox
+		if err := tx.Where("chat_id = ? AND target_id = 0 AND status = ?", chatId, OutboxPending).Find(&messages).Error; err != nil {
+			return err
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+		letters := make([]*DeadLetter, 0, len(messages))
+		ids := make([]uint, 0, len(messages))
+		for _, o := range messages {
+			letters = append(letters, newDeadLetter(o, reason, true))
+			ids = append(ids, o.ID)
+		}
+		err := tx.Model(&Outbox{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":     OutboxFailed,
+			"last_error": reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		count = int64(len(letters))
+		return tx.Create(&letters).Error
+	})
+	return count, err
+}
+
+// ListDeadLetters 按时间倒序查询死信, all 为 false 时只返回未重新发送的
+func ListDeadLetters(all bool, limit int) []DeadLetter {
+	var letters []DeadLetter
+	query := db.Order("id desc").Limit(limit)
+	if !all {
+		query = query.Where("replayed_at IS NULL")
+	}
+	query.Find(&letters)
+	return letters
+}
+
+// ReplayDeadLetters 将死信重新写入发件箱, ids 为空时重新发送所有未处理的死信, 返回重新发送的条数
+func ReplayDeadLetters(ids []uint) (int, error) {
+	var count int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var letters []*DeadLetter
+		query := tx.Where("replayed_at IS NULL").Order("id asc")
+		if len(ids) > 0 {
+			query = query.Where("id IN ?", ids)
+		}
+		if err := query.Find(&letters).Error; err != nil {
+			return err
+		}
+		if len(letters) == 0 {
+			return errors.New("没有需要重新发送的消息")
+		}
+
+		now := time.Now()
+		messages := make([]*Outbox, 0, len(letters))
+		replayed := make([]uint, 0, len(letters))
+		for _, d := range letters {
+			messages = append(messages, &Outbox{
+				ChatId:   d.ChatId,
+				TargetId: d.TargetId,
+				Title:    d.Title,
+				Url:      d.Url,
+				Text:     d.Text,
+				MsgType:  d.MsgType,
+				Silent:   d.Silent,
+			})
+			replayed = append(replayed, d.ID)
+		}
+		prepareOutbox(messages)
+		if err := tx.Create(&messages).Error; err != nil {
+			return err
+		}
+		count = len(letters)
+		return tx.Model(&DeadLetter{}).Where("id IN ?", replayed).Update("replayed_at", &now).Error
+	})
+	return count, err
+}
+
+// CountDeadLetters 未重新发送的死信数
+func CountDeadLetters() int64 {
+	var count int64
+	db.Model(&DeadLetter{}).Where("replayed_at IS NULL").Count(&count)
+	return count
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DigestItem 等待汇总推送的命中条目
+type DigestItem struct {
+	ID          uint       `gorm:"primaryKey,autoIncrement"`
+	ChatId      int64      `gorm:"not null;index"`
+	FeedId      string     `gorm:"not null"`
+	FeedName    string     `gorm:"not null"`
+	Title       string     `gorm:"not null"`
+	Url         string     `gorm:"not null"`
+	PublishedAt *time.Time `gorm:"default:null"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+}
+
+func (d DigestItem) TableName() string {
+	return "digest_item"
+}
+
+// ListDigestChatIds 有待汇总条目的聊天
+func ListDigestChatIds() []int64 {
+	var chatIds []int64
+	db.Model(&DigestItem{}).Distinct("chat_id").Pluck("chat_id", &chatIds)
+	return chatIds
+}
+
+// ListDigestItems 按命中顺序查询聊天待汇总的条目
+func ListDigestItems(chatId int64) []DigestItem {
+	var items []DigestItem
+	db.Where("chat_id = ?", chatId).Order("id asc").Find(&items)
+	return items
+}
+
+// FlushDigest 将汇总后的消息写入发件箱, 并删除已汇总的条目
+func FlushDigest(itemIds []uint, messages []*Outbox) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(messages) > 0 {
+			prepareOutbox(messages)
+			if err := tx.Create(&messages).Error; err != nil {
+				return err
+			}
+		}
+		if len(itemIds) == 0 {
+			return nil
+		}
+		return tx.Where("id IN ?", itemIds).Delete(&DigestItem{}).Error
+	})
+}
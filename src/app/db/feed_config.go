@@ -1,16 +1,67 @@
 package db
 
+import (
+	"strings"
+
+	json "github.com/bytedance/sonic"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ImpersonateChrome  = "chrome"
+	ImpersonateFirefox = "firefox"
+	ImpersonateSafari  = "safari"
+	ImpersonateOff     = "off"
+)
+
+// nodelocFeedMarker nodeloc 的 feed 地址包含该字符串, 不支持模拟浏览器指纹
+const nodelocFeedMarker = "nodeloc_rss"
+
 type FeedConfig struct {
 	ID      uint   `gorm:"primaryKey,autoIncrement" json:"id"`
 	Name    string `gorm:"not null" json:"name"`
 	FeedUrl string `gorm:"not null" json:"feedUrl"`
 	FeedId  string `gorm:"not null;uniqueIndex" json:"feedId"`
+	Paused  bool   `gorm:"not null;default:false" json:"paused"` // 暂停后不再抓取, 菜单中隐藏
+	// 抓取设置, 时长格式如 10s、5m, 为空时使用默认值
+	MinInterval string            `json:"minInterval"` // 最小抓取间隔
+	MaxInterval string            `json:"maxInterval"` // 最大抓取间隔
+	Timeout     string            `json:"timeout"`     // 请求超时时间
+	Headers     string            `json:"-"`
+	HeadersMap  map[string]string `gorm:"-" json:"headers"` // 自定义请求头
+	Cookies     string            `json:"cookies"`          // Cookie 请求头, 如 a=1; b=2
+	Proxy       string            `json:"proxy"`            // http/https/socks5 代理地址
+	Impersonate string            `json:"impersonate"`      // 模拟的浏览器指纹: chrome(默认)、firefox、safari、off
+	Template    string            `json:"template"`         // 消息模板, 订阅者未设置模板时使用, 为空时使用内置模板
 }
 
 func (f FeedConfig) TableName() string {
 	return "feed_config"
 }
 
+// BeforeSave 在保存到数据库前将 HeadersMap 序列化为 Headers
+func (f *FeedConfig) BeforeSave(tx *gorm.DB) error {
+	if len(f.HeadersMap) > 0 {
+		headers, err := json.Marshal(f.HeadersMap)
+		if err != nil {
+			return err
+		}
+		f.Headers = string(headers)
+	} else {
+		f.Headers = ""
+	}
+	return nil
+}
+
+// AfterFind 在从数据库读取后将 Headers 反序列化为 HeadersMap
+func (f *FeedConfig) AfterFind(tx *gorm.DB) error {
+	if f.Headers != "" {
+		return json.Unmarshal([]byte(f.Headers), &f.HeadersMap)
+	}
+	return nil
+}
+
 func ListAllFeedConfig() []FeedConfig {
 	var feedConfigs []FeedConfig
 	db.Find(&feedConfigs)
@@ -28,12 +79,70 @@ func AddOrUpdateFeed(config FeedConfig) {
 	if exists.ID > 0 {
 		//// 根据 `struct` 更新属性，只会更新非零值的字段
 		//db.Model(&user).Updates(User{Name: "hello", Age: 18, Active: false})
-		db.Model(&FeedConfig{}).Where("id = ?", exists.ID).Updates(FeedConfig{
-			Name:    config.Name,
-			FeedUrl: config.FeedUrl,
-			FeedId:  config.FeedId,
-		})
+		update := FeedConfig{
+			Name:        config.Name,
+			FeedUrl:     config.FeedUrl,
+			FeedId:      config.FeedId,
+			Impersonate: exists.Impersonate,
+		}
+		defaultFeedImpersonate(&update)
+		db.Model(&FeedConfig{}).Where("id = ?", exists.ID).Updates(update)
 		return
 	}
+	defaultFeedImpersonate(&config)
 	db.Create(&config)
 }
+
+// defaultFeedImpersonate nodeloc 未设置浏览器指纹时关闭模拟
+func defaultFeedImpersonate(config *FeedConfig) {
+	if config.Impersonate == "" && strings.Contains(config.FeedUrl, nodelocFeedMarker) {
+		config.Impersonate = ImpersonateOff
+	}
+}
+
+// SaveFeedConfig 保存 feed 的全部字段, 可以将抓取设置清空为默认值
+func SaveFeedConfig(config FeedConfig) error {
+	defaultFeedImpersonate(&config)
+	var exists = GetFeedConfigWithFeedId(config.FeedId)
+	if exists.ID > 0 {
+		config.ID = exists.ID
+		return db.Save(&config).Error
+	}
+	return db.Create(&config).Error
+}
+
+// DeleteFeedConfig 删除 feed 及其订阅、抓取状态、历史条目、webhook 和尚未发送的消息
+func DeleteFeedConfig(feedId string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("feed_id = ?", feedId).Delete(&SubscribeConfig{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("feed_id = ?", feedId).Delete(&FeedState{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("feed_id = ?", feedId).Delete(&FeedItem{}).Error; err != nil {
+			return err
+		}
+		webhookIds := tx.Model(&Webhook{}).Select("id").Where("feed_id = ?", feedId)
+		if err := tx.Where("webhook_id IN (?)", webhookIds).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("feed_id = ?", feedId).Delete(&Webhook{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("feed_id = ?", feedId).Delete(&DigestItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("feed_id = ? AND status = ?", feedId, OutboxPending).Delete(&Outbox{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("feed_id = ?", feedId).Delete(&FeedConfig{}).Error
+	})
+}
+
+// migrateFeedImpersonate 已保存的 nodeloc 未设置浏览器指纹时关闭模拟, 之后保存时由 defaultFeedImpersonate 设置
+func migrateFeedImpersonate() error {
+	return db.Model(&FeedConfig{}).
+		Where("feed_url LIKE ? AND (impersonate IS NULL OR impersonate = '')", "%"+nodelocFeedMarker+"%").
+		UpdateColumn("impersonate", ImpersonateOff).Error
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeedItem 抓取到的 RSS 条目, 用于历史查询、关键字回溯和排查通知问题
+type FeedItem struct {
+	ID              uint       `gorm:"primaryKey,autoIncrement" json:"id"`
+	FeedId          string     `gorm:"not null;uniqueIndex:idx_feed_item_guid;index:idx_feed_item_seen" json:"feedId"`
+	Guid            string     `gorm:"not null;uniqueIndex:idx_feed_item_guid" json:"guid"`
+	Url             string     `gorm:"not null;index" json:"url"` // 去除锚点后的链接
+	Title           string     `gorm:"not null" json:"title"`
+	Description     string     `json:"description"` // 去除 html 标签后的正文
+	Author          string     `json:"author"`
+	Categories      string     `json:"-"`
+	CategoriesArray []string   `gorm:"-" json:"categories"`
+	PublishedAt     *time.Time `json:"publishedAt"`
+	FirstSeenAt     time.Time  `gorm:"not null;index:idx_feed_item_seen" json:"firstSeenAt"`
+}
+
+func (f FeedItem) TableName() string {
+	return "feed_item"
+}
+
+// BeforeSave 在保存到数据库前将 CategoriesArray 序列化为 Categories
+func (f *FeedItem) BeforeSave(tx *gorm.DB) error {
+	if len(f.CategoriesArray) > 0 {
+		categories, err := json.Marshal(f.CategoriesArray)
+		if err != nil {
+			return err
+		}
+		f.Categories = string(categories)
+	} else {
+		f.Categories = ""
+	}
+	return nil
+}
+
+// AfterFind 在从数据库读取后将 Categories 反序列化为 CategoriesArray
+func (f *FeedItem) AfterFind(tx *gorm.DB) error {
+	if f.Categories != "" {
+		return json.Unmarshal([]byte(f.Categories), &f.CategoriesArray)
+	}
+	return nil
+}
+
+// SaveFeedItems 批量保存条目, 已存在的(feed_id + guid)条目忽略, 返回新增数量
+func SaveFeedItems(items []*FeedItem) (int64, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(items, 100)
+	return result.RowsAffected, result.Error
+}
+
+// ListRecentFeedItems 查询 feed 最近的条目, 最新的在前
+func ListRecentFeedItems(feedId string, limit int) []*FeedItem {
+	var items []*FeedItem
+	db.Where("feed_id = ?", feedId).Order("first_seen_at desc, id desc").Limit(limit).Find(&items)
+	return items
+}
+
+// ListFeedItemsSince 查询 feed 在 since 之后首次抓取到的条目, 最新的在前
+func ListFeedItemsSince(feedId string, since time.Time, limit int) []*FeedItem {
+	var items []*FeedItem
+	db.Where("feed_id = ? AND first_seen_at >= ?", feedId, since).Order("first_seen_at desc, id desc").Limit(limit).Find(&items)
+	return items
+}
+
+// SearchFeedItems 按标题搜索 feed 的历史条目, feedId 为空时搜索所有 feed
+func SearchFeedItems(feedId string, title string, limit int) []*FeedItem {
+	var items []*FeedItem
+	query := db.Where("title LIKE ?", "%"+title+"%")
+	if feedId != "" {
+		query = query.Where("feed_id = ?", feedId)
+	}
+	query.Order("first_seen_at desc, id desc").Limit(limit).Find(&items)
+	return items
+}
+
+// GetFeedItemWithUrl 按链接查询条目
+func GetFeedItemWithUrl(url string) *FeedItem {
+	var item FeedItem
+	db.Where("url = ?", url).Order("id desc").First(&item)
+	if item.ID == 0 {
+		return nil
+	}
+	return &item
+}
+
+// DeleteFeedItemsBefore 删除 before 之前首次抓取到的条目
+func DeleteFeedItemsBefore(before time.Time) (int64, error) {
+	result := db.Where("first_seen_at < ?", before).Delete(&FeedItem{})
+	return result.RowsAffected, result.Error
+}
+
+// TrimFeedItems 每个 feed 只保留最新的 keep 条
+func TrimFeedItems(feedId string, keep int) (int64, error) {
+	result := db.Where("feed_id = ? AND id NOT IN (?)", feedId,
+		db.Model(&FeedItem{}).Select("id").Where("feed_id = ?", feedId).Order("first_seen_at desc, id desc").Limit(keep),
+	).Delete(&FeedItem{})
+	return result.RowsAffected, result.Error
+}
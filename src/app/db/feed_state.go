@@ -0,0 +1,71 @@
+package db
+
+import "time"
+
+// FeedState 记录每个 feed 的抓取状态, 用于条件请求和健康检查
+type FeedState struct {
+	ID           uint   `gorm:"primaryKey,autoIncrement" json:"id"`
+	FeedId       string `gorm:"not null;uniqueIndex" json:"feedId"`
+	FeedUrl      string `gorm:"not null" json:"feedUrl"` // 验证信息对应的地址, 地址变更后失效
+	ETag         string `gorm:"column:etag" json:"etag"`
+	LastModified string `json:"lastModified"`
+	// 健康状态
+	LastSuccessAt       *time.Time `json:"lastSuccessAt"`
+	LastErrorAt         *time.Time `json:"lastErrorAt"`
+	LastError           string     `json:"lastError"`
+	LastStatus          int        `json:"lastStatus"`          // 最近一次请求的 http 状态码, 网络错误时为 0
+	LastItemCount       int        `json:"lastItemCount"`       // 最近一次成功抓取的条目数
+	ConsecutiveFailures int        `json:"consecutiveFailures"` // 连续失败次数
+	Interval            int64      `json:"interval"`            // 当前抓取间隔(秒)
+	Alerting            bool       `json:"alerting"`            // 已发送故障告警, 恢复后发送恢复通知
+	UpdatedAt           time.Time  `json:"updatedAt"`
+}
+
+func (f FeedState) TableName() string {
+	return "feed_state"
+}
+
+func GetFeedState(feedId string) FeedState {
+	var state FeedState
+	db.Where("feed_id = ?", feedId).First(&state)
+	return state
+}
+
+func ListFeedStates() []FeedState {
+	var states []FeedState
+	db.Find(&states)
+	return states
+}
+
+// SaveFeedState 保存 feed 的条件请求验证信息, 不存在时新建
+func SaveFeedState(state FeedState) error {
+	return saveFeedStateColumns(state, map[string]interface{}{
+		"feed_url":      state.FeedUrl,
+		"etag":          state.ETag,
+		"last_modified": state.LastModified,
+	})
+}
+
+// SaveFeedHealth 保存 feed 的健康状态, 不存在时新建
+func SaveFeedHealth(state FeedState) error {
+	return saveFeedStateColumns(state, map[string]interface{}{
+		"last_success_at":      state.LastSuccessAt,
+		"last_error_at":        state.LastErrorAt,
+		"last_error":           state.LastError,
+		"last_status":          state.LastStatus,
+		"last_item_count":      state.LastItemCount,
+		"consecutive_failures": state.ConsecutiveFailures,
+		"interval":             state.Interval,
+		"alerting":             state.Alerting,
+	})
+}
+
+func saveFeedStateColumns(state FeedState, columns map[string]interface{}) error {
+	var exists = GetFeedState(state.FeedId)
+	if exists.ID > 0 {
+		columns["updated_at"] = time.Now()
+		return db.Model(&FeedState{}).Where("id = ?", exists.ID).Updates(columns).Error
+	}
+	state.ID = 0
+	return db.Create(&state).Error
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type NotifyHistory struct {
@@ -198,7 +200,27 @@ func GetNotifyHistoryBatch(chatId int64, urls []string) map[string]bool {
 
 // AddNotifyHistoryBatch 批量添加通知历史
 func AddNotifyHistoryBatch(histories []*NotifyHistory) error {
-	if len(histories) == 0 {
+	return addNotifyHistory(histories, false, nil)
+}
+
+// AddNotifyHistoryWithOutbox 在同一事务中写入通知历史和待发送的消息, 避免记录了历史但消息丢失
+func AddNotifyHistoryWithOutbox(histories []*NotifyHistory, messages []*Outbox) error {
+	return addNotifyHistory(histories, len(messages) > 0, func(tx *gorm.DB) error {
+		prepareOutbox(messages)
+		return tx.Create(&messages).Error
+	})
+}
+
+// AddNotifyHistoryWithDigest 在同一事务中写入通知历史和摘要条目
+func AddNotifyHistoryWithDigest(histories []*NotifyHistory, items []*DigestItem) error {
+	return addNotifyHistory(histories, len(items) > 0, func(tx *gorm.DB) error {
+		return tx.Create(&items).Error
+	})
+}
+
+// addNotifyHistory 批量写入通知历史, create 在同一事务中写入关联的数据
+func addNotifyHistory(histories []*NotifyHistory, hasExtra bool, create func(tx *gorm.DB) error) error {
+	if len(histories) == 0 && !hasExtra {
 		return nil
 	}
 
@@ -215,9 +237,17 @@ func AddNotifyHistoryBatch(histories []*NotifyHistory) error {
 	}()
 
 	// 批量插入
-	if err := tx.Create(&histories).Error; err != nil {
-		tx.Rollback()
-		return err
+	if len(histories) > 0 {
+		if err := tx.Create(&histories).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if hasExtra {
+		if err := create(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
 	}
 
 	// 提交事务
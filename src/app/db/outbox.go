@@ -0,0 +1,111 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 发件箱消息状态
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// Outbox 待发送的通知消息, 与通知历史在同一事务中写入, 重启后继续发送
+type Outbox struct {
+	ID            uint       `gorm:"primaryKey,autoIncrement" json:"id"`
+	ChatId        int64      `gorm:"not null;index" json:"chatId"`
+	TargetId      uint       `gorm:"not null;default:0" json:"targetId"` // 推送目标, 0 表示 Telegram
+	FeedId        string     `gorm:"index" json:"feedId"`                // 命中条目所属的 feed, 汇总等消息为空
+	Title         string     `json:"title"`                              // 其它推送目标使用的标题和链接
+	Url           string     `json:"url"`
+	Text          string     `gorm:"not null" json:"text"`
+	MsgType       string     `json:"msgType"`
+	Silent        bool       `gorm:"not null;default:false" json:"silent"` // 免打扰时段内静默发送
+	Status        string     `gorm:"not null;index:idx_outbox_status" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	LastError     string     `json:"lastError"`
+	NextAttemptAt time.Time  `gorm:"index:idx_outbox_status" json:"nextAttemptAt"` // 最早的发送时间
+	Reserved      bool       `gorm:"not null;default:false" json:"reserved"`       // NextAttemptAt 是频率限制预定的发送时间, 发送时不再消耗令牌
+	SentAt        *time.Time `json:"sentAt"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (o Outbox) TableName() string {
+	return "outbox"
+}
+
+// AddOutbox 添加待发送的消息
+func AddOutbox(messages []*Outbox) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	prepareOutbox(messages)
+	return db.Create(&messages).Error
+}
+
+func prepareOutbox(messages []*Outbox) {
+	now := time.Now()
+	for _, m := range messages {
+		if m.Status == "" {
+			m.Status = OutboxPending
+		}
+		if m.NextAttemptAt.IsZero() {
+			m.NextAttemptAt = now
+		}
+	}
+}
+
+// ListPendingOutbox 按写入顺序查询已到发送时间的消息
+func ListPendingOutbox(limit int) []*Outbox {
+	var messages []*Outbox
+	db.Where("status = ? AND next_attempt_at <= ?", OutboxPending, time.Now()).
+		Order("id asc").Limit(limit).Find(&messages)
+	return messages
+}
+
+// CountPendingOutbox 待发送的消息数
+func CountPendingOutbox() int64 {
+	var count int64
+	db.Model(&Outbox{}).Where("status = ?", OutboxPending).Count(&count)
+	return count
+}
+
+// MarkOutboxSent 标记消息已发送
+func MarkOutboxSent(id uint) error {
+	now := time.Now()
+	return db.Model(&Outbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     OutboxSent,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"last_error": "",
+		"sent_at":    &now,
+	}).Error
+}
+
+// RescheduleOutbox 推迟消息到频率限制预定的发送时间, 消息保持待发送状态
+func RescheduleOutbox(id uint, at time.Time, reason string) error {
+	return db.Model(&Outbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"next_attempt_at": at,
+		"reserved":        true,
+		"last_error":      reason,
+	}).Error
+}
+
+// RetryOutbox 发送失败后推迟重试, 并增加重试次数
+func RetryOutbox(id uint, at time.Time, reason string) error {
+	return db.Model(&Outbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"next_attempt_at": at,
+		"reserved":        false,
+		"last_error":      reason,
+	}).Error
+}
+
+// DeleteOutboxBefore 删除 before 之前已发送的消息
+func DeleteOutboxBefore(before time.Time) (int64, error) {
+	result := db.Where("status = ? AND created_at < ?", OutboxSent, before).Delete(&Outbox{})
+	return result.RowsAffected, result.Error
+}
@@ -12,6 +12,31 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// 订阅者无法送达时的状态, 用户再次与机器人交互后恢复为 on
+const (
+	SubscribeStatusBlocked = "blocked" // 用户屏蔽了机器人
+	SubscribeStatusKicked  = "kicked"  // 机器人被移出群组或频道
+)
+
+// 推送方式
+const (
+	DeliveryInstant = "instant" // 命中后立即推送
+	DeliveryHourly  = "hourly"  // 每小时汇总推送
+	DeliveryDaily   = "daily"   // 每天在指定时间汇总推送
+)
+
+// DefaultDigestTime 每日摘要默认的推送时间
+const DefaultDigestTime = "09:00"
+
+// DefaultTimezone 订阅者默认的时区
+const DefaultTimezone = "Asia/Shanghai"
+
+// 免打扰时段内的处理方式
+const (
+	QuietHold   = "hold"   // 暂存, 免打扰结束后汇总推送
+	QuietSilent = "silent" // 照常推送, 但不发出提醒
+)
+
 type Subscribe struct {
 	ID            uint     `gorm:"primaryKey,autoIncrement"`
 	Name          string   `gorm:"not null"`
@@ -20,6 +45,14 @@ type Subscribe struct {
 	KeywordsArray []string `gorm:"-"`
 	Status        string
 	Type          string
+	DeliveryMode  string    `gorm:"not null;default:'instant'"`       // 推送方式, 为空视为 instant
+	DigestTime    string    `gorm:"not null;default:'09:00'"`         // 每日摘要的推送时间, HH:MM
+	Timezone      string    `gorm:"not null;default:'Asia/Shanghai'"` // IANA 时区, 用于显示时间和计算推送时间
+	QuietStart    string    // 免打扰开始时间, HH:MM, 为空表示未开启
+	QuietEnd      string    // 免打扰结束时间, HH:MM
+	QuietMode     string    `gorm:"not null;default:'hold'"` // 免打扰时段内的处理方式
+	Template      string    // 自定义消息模板, 为空时使用 feed 的模板
+	TelegramOff   bool      `gorm:"not null;default:false"` // 命中的帖子不推送到 Telegram, 只推送到其它启用的目标
 	CreatedAt     time.Time `gorm:"autoCreateTime"`
 	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
 }
@@ -86,18 +119,25 @@ func InitDB(dbPath string) error {
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
 	// Auto migrate the schema
-	err = db.AutoMigrate(&Subscribe{}, &NotifyHistory{}, &FeedConfig{}, &SubscribeConfig{})
+	err = db.AutoMigrate(&Subscribe{}, &NotifyHistory{}, &FeedConfig{}, &SubscribeConfig{}, &FeedItem{}, &FeedState{}, &Outbox{}, &DeadLetter{}, &DigestItem{}, &NotifyTarget{}, &Webhook{}, &WebhookDelivery{})
 	if err != nil {
 		return err
 	}
+	if err = migrateFeedImpersonate(); err != nil {
+		return err
+	}
 
-	//默认添加ns
-	var ns = FeedConfig{
-		Name:    "NodeSeek",
-		FeedUrl: "https://rss.nodeseek.com",
-		FeedId:  "ns",
+	//没有任何feed时默认添加ns, 删除后不再自动恢复
+	var count int64
+	db.Model(&FeedConfig{}).Count(&count)
+	if count == 0 {
+		var ns = FeedConfig{
+			Name:    "NodeSeek",
+			FeedUrl: "https://rss.nodeseek.com",
+			FeedId:  "ns",
+		}
+		AddOrUpdateFeed(ns)
 	}
-	AddOrUpdateFeed(ns)
 	return nil
 }
 
@@ -126,6 +166,57 @@ func UpdateSubscribe(sub *Subscribe) error {
 	return db.Save(sub).Error
 }
 
+// UpdateSubscribeStatus 只更新订阅者的状态
+func UpdateSubscribeStatus(chatId int64, status string) error {
+	return db.Model(&Subscribe{}).Where("chat_id = ?", chatId).UpdateColumns(map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// UpdateSubscribeDelivery 更新订阅者的推送方式
+func UpdateSubscribeDelivery(chatId int64, mode string, digestTime string) error {
+	return db.Model(&Subscribe{}).Where("chat_id = ?", chatId).UpdateColumns(map[string]interface{}{
+		"delivery_mode": mode,
+		"digest_time":   digestTime,
+		"updated_at":    time.Now(),
+	}).Error
+}
+
+// UpdateSubscribeTimezone 更新订阅者的时区
+func UpdateSubscribeTimezone(chatId int64, timezone string) error {
+	return db.Model(&Subscribe{}).Where("chat_id = ?", chatId).UpdateColumns(map[string]interface{}{
+		"timezone":   timezone,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// UpdateSubscribeQuiet 更新订阅者的免打扰时段, start 为空时关闭
+func UpdateSubscribeQuiet(chatId int64, start, end, mode string) error {
+	return db.Model(&Subscribe{}).Where("chat_id = ?", chatId).UpdateColumns(map[string]interface{}{
+		"quiet_start": start,
+		"quiet_end":   end,
+		"quiet_mode":  mode,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// UpdateSubscribeTelegramOff 设置命中的帖子是否推送到 Telegram
+func UpdateSubscribeTelegramOff(chatId int64, off bool) error {
+	return db.Model(&Subscribe{}).Where("chat_id = ?", chatId).UpdateColumns(map[string]interface{}{
+		"telegram_off": off,
+		"updated_at":   time.Now(),
+	}).Error
+}
+
+// UpdateSubscribeTemplate 更新订阅者的消息模板, 为空时恢复默认
+func UpdateSubscribeTemplate(chatId int64, template string) error {
+	return db.Model(&Subscribe{}).Where("chat_id = ?", chatId).UpdateColumns(map[string]interface{}{
+		"template":   template,
+		"updated_at": time.Now(),
+	}).Error
+}
+
 // DeleteSubscribe deletes a subscription by ID
 func DeleteSubscribe(chatId int64) error {
 	return db.Where("chat_id = ?", chatId).Delete(&Subscribe{}).Error
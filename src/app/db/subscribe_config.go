@@ -9,13 +9,23 @@ import (
 )
 
 type SubscribeConfig struct {
-	ID            uint      `gorm:"primaryKey,autoIncrement"`
-	ChatId        int64     `gorm:"not null,index"`
-	Keywords      string    `gorm:"not null"`
-	KeywordsArray []string  `gorm:"-"`
-	FeedId        string    `gorm:"not null"`
-	CreatedAt     time.Time `gorm:"autoCreateTime"`
-	UpdatedAt     time.Time `gorm:"autoUpdateTime"`
+	ID            uint     `gorm:"primaryKey,autoIncrement"`
+	ChatId        int64    `gorm:"not null,index"`
+	Keywords      string   `gorm:"not null"`
+	KeywordsArray []string `gorm:"-"`
+	// 因匹配超时被自动停用的关键字
+	DisabledKeywords      string
+	DisabledKeywordsArray []string `gorm:"-"`
+	// 升级前保存、按新语法含义不同的关键字, 仍按升级前的方式匹配
+	LegacyKeywords      string
+	LegacyKeywordsArray []string `gorm:"-"`
+	// 是否已检查过升级前保存的关键字, 之后添加的关键字都按新语法匹配
+	KeywordsChecked bool `gorm:"not null;default:false"`
+	// 是否已通知订阅者哪些关键字仍按升级前的方式匹配
+	LegacyNotified bool      `gorm:"not null;default:false"`
+	FeedId         string    `gorm:"not null"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
 }
 
 func (s *SubscribeConfig) TableName() string {
@@ -45,17 +55,65 @@ func (s *SubscribeConfig) BeforeSave(tx *gorm.DB) error {
 	} else {
 		s.Keywords = ""
 	}
+	if len(s.DisabledKeywordsArray) > 0 {
+		disabled, err := json.Marshal(s.DisabledKeywordsArray)
+		if err != nil {
+			return err
+		}
+		s.DisabledKeywords = string(disabled)
+	} else {
+		s.DisabledKeywords = ""
+	}
+	if len(s.LegacyKeywordsArray) > 0 {
+		legacy, err := json.Marshal(s.LegacyKeywordsArray)
+		if err != nil {
+			return err
+		}
+		s.LegacyKeywords = string(legacy)
+	} else {
+		s.LegacyKeywords = ""
+	}
 	return nil
 }
 
 // AfterFind 在从数据库读取后将 Keywords 反序列化为 KeywordsArray
 func (s *SubscribeConfig) AfterFind(tx *gorm.DB) error {
 	if s.Keywords != "" {
-		return json.Unmarshal([]byte(s.Keywords), &s.KeywordsArray)
+		if err := json.Unmarshal([]byte(s.Keywords), &s.KeywordsArray); err != nil {
+			return err
+		}
+	}
+	if s.DisabledKeywords != "" {
+		if err := json.Unmarshal([]byte(s.DisabledKeywords), &s.DisabledKeywordsArray); err != nil {
+			return err
+		}
+	}
+	if s.LegacyKeywords != "" {
+		return json.Unmarshal([]byte(s.LegacyKeywords), &s.LegacyKeywordsArray)
 	}
 	return nil
 }
 
+// IsKeywordDisabled 判断关键字是否已被停用
+func (s *SubscribeConfig) IsKeywordDisabled(keyword string) bool {
+	for _, v := range s.DisabledKeywordsArray {
+		if v == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLegacyKeyword 判断关键字是否按升级前的方式匹配
+func (s *SubscribeConfig) IsLegacyKeyword(keyword string) bool {
+	for _, v := range s.LegacyKeywordsArray {
+		if v == keyword {
+			return true
+		}
+	}
+	return false
+}
+
 func ListSubscribeFeedConfig(chatId int64) map[string][]string {
 	var cnf []*SubscribeConfig
 	db.Where("chat_id = ?", chatId).Find(&cnf)
@@ -71,3 +129,55 @@ func ListSubscribeFeedWith(chatId int64, feedId string) SubscribeConfig {
 	db.Where("chat_id = ? and feed_id = ?", chatId, feedId).First(&cnf)
 	return cnf
 }
+
+// ListSubscribeConfigWithFeedId 查询订阅了该 feed 的所有配置
+func ListSubscribeConfigWithFeedId(feedId string) []SubscribeConfig {
+	var cnf []SubscribeConfig
+	db.Where("feed_id = ?", feedId).Find(&cnf)
+	return cnf
+}
+
+// ListAllSubscribeConfig 查询所有订阅配置
+func ListAllSubscribeConfig() []SubscribeConfig {
+	var cnf []SubscribeConfig
+	db.Find(&cnf)
+	return cnf
+}
+
+// CheckSubscribeKeywords 记录尚未检查的订阅中按升级前的方式匹配的关键字, 只更新这几列, 避免覆盖同时修改的关键字
+// 订阅已检查过时返回 false
+func CheckSubscribeKeywords(id uint, legacy []string) (bool, error) {
+	var legacyKeywords string
+	if len(legacy) > 0 {
+		b, err := json.Marshal(legacy)
+		if err != nil {
+			return false, err
+		}
+		legacyKeywords = string(b)
+	}
+	result := db.Model(&SubscribeConfig{}).Where("id = ? AND keywords_checked = ?", id, false).
+		UpdateColumns(map[string]any{
+			"legacy_keywords":  legacyKeywords,
+			"keywords_checked": true,
+			"legacy_notified":  len(legacy) == 0,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkSubscribeLegacyNotified 记录已通知订阅者哪些关键字按升级前的方式匹配
+func MarkSubscribeLegacyNotified(id uint) error {
+	return db.Model(&SubscribeConfig{}).Where("id = ?", id).UpdateColumn("legacy_notified", true).Error
+}
+
+// DisableSubscribeKeyword 停用订阅中的某个关键字
+func DisableSubscribeKeyword(chatId int64, feedId string, keyword string) error {
+	cnf := ListSubscribeFeedWith(chatId, feedId)
+	if cnf.ID == 0 {
+		return nil
+	}
+	if cnf.IsKeywordDisabled(keyword) {
+		return nil
+	}
+	cnf.DisabledKeywordsArray = append(cnf.DisabledKeywordsArray, keyword)
+	return db.Save(&cnf).Error
+}
@@ -0,0 +1,225 @@
+package db
+
+import (
+	"time"
+
+	json "github.com/bytedance/sonic"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Webhook 通过 API 注册的 webhook, 命中关键字的帖子以 JSON 推送到 Url
+type Webhook struct {
+	ID             uint      `gorm:"primaryKey,autoIncrement" json:"id"`
+	FeedId         string    `gorm:"not null;index" json:"feedId"`
+	Url            string    `gorm:"not null" json:"url"`
+	Secret         string    `gorm:"not null" json:"-"` // 计算 X-Signature 的密钥
+	Keywords       string    `gorm:"not null" json:"-"`
+	KeywordsArray  []string  `gorm:"-" json:"keywords"`
+	Enabled        bool      `gorm:"not null;default:true" json:"enabled"`
+	DisabledReason string    `gorm:"not null;default:''" json:"disabledReason"` // 停用原因, 启用时为空
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (w *Webhook) TableName() string {
+	return "webhook"
+}
+
+// BeforeSave 在保存到数据库前将 KeywordsArray 序列化为 Keywords
+func (w *Webhook) BeforeSave(tx *gorm.DB) error {
+	keywords, err := json.Marshal(w.KeywordsArray)
+	if err != nil {
+		return err
+	}
+	w.Keywords = string(keywords)
+	return nil
+}
+
+// AfterFind 在从数据库读取后将 Keywords 反序列化为 KeywordsArray
+func (w *Webhook) AfterFind(tx *gorm.DB) error {
+	if w.Keywords == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(w.Keywords), &w.KeywordsArray)
+}
+
+// SaveWebhook 添加或更新 webhook
+func SaveWebhook(w *Webhook) error {
+	if err := db.Save(w).Error; err != nil {
+		return err
+	}
+	// 新建时零值字段会使用数据库默认值, 需要单独更新
+	if !w.Enabled {
+		return db.Model(w).UpdateColumn("enabled", false).Error
+	}
+	return nil
+}
+
+func GetWebhook(id uint) *Webhook {
+	var w Webhook
+	if err := db.Where("id = ?", id).First(&w).Error; err != nil {
+		return nil
+	}
+	return &w
+}
+
+func ListWebhooks() []*Webhook {
+	var webhooks []*Webhook
+	db.Order("id asc").Find(&webhooks)
+	return webhooks
+}
+
+// ListEnabledWebhooksWithFeedId 查询 feed 启用的 webhook
+func ListEnabledWebhooksWithFeedId(feedId string) []*Webhook {
+	var webhooks []*Webhook
+	db.Where("feed_id = ? AND enabled = ?", feedId, true).Order("id asc").Find(&webhooks)
+	return webhooks
+}
+
+// webhook 停用原因
+const (
+	WebhookDisabledManual       = "manual"        // 通过 API 停用
+	WebhookDisabledRegexTimeout = "regex_timeout" // 关键字中的正则多次匹配超时
+)
+
+// DisableWebhook 停用 webhook 并记录原因
+func DisableWebhook(id uint, reason string) error {
+	return db.Model(&Webhook{}).Where("id = ?", id).
+		UpdateColumns(map[string]any{"enabled": false, "disabled_reason": reason}).Error
+}
+
+// DeleteWebhook 删除 webhook 及其投递记录
+func DeleteWebhook(id uint) (int64, error) {
+	var n int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", id).Delete(&Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		n = result.RowsAffected
+		return tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error
+	})
+	return n, err
+}
+
+// webhook 投递状态
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery webhook 的投递记录, 同时作为待投递的队列, 同一 webhook 的同一帖子只投递一次
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primaryKey,autoIncrement" json:"id"`
+	WebhookId     uint       `gorm:"not null;uniqueIndex:idx_webhook_delivery_link" json:"webhookId"`
+	Link          string     `gorm:"not null;uniqueIndex:idx_webhook_delivery_link" json:"link"`
+	Title         string     `json:"title"`
+	Rule          string     `json:"rule"`              // 命中的关键字
+	Payload       string     `gorm:"not null" json:"-"` // 推送的 JSON, 重试时原样发送
+	Status        string     `gorm:"not null;index:idx_webhook_delivery_status" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	StatusCode    int        `json:"statusCode"` // 最近一次请求的 http 状态码
+	LastError     string     `json:"lastError"`
+	NextAttemptAt time.Time  `gorm:"index:idx_webhook_delivery_status" json:"nextAttemptAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (d WebhookDelivery) TableName() string {
+	return "webhook_delivery"
+}
+
+// AddWebhookDeliveries 添加待投递的记录, 已投递过的帖子忽略, 返回新增的条数
+func AddWebhookDeliveries(deliveries []*WebhookDelivery) (int64, error) {
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	for _, d := range deliveries {
+		d.Status = DeliveryPending
+		d.NextAttemptAt = now
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries)
+	return result.RowsAffected, result.Error
+}
+
+// ListPendingWebhookDeliveries 按写入顺序查询已到投递时间的记录
+func ListPendingWebhookDeliveries(limit int) []*WebhookDelivery {
+	var deliveries []*WebhookDelivery
+	db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, time.Now()).
+		Order("id asc").Limit(limit).Find(&deliveries)
+	return deliveries
+}
+
+// CountPendingWebhookDeliveries 等待投递的记录数
+func CountPendingWebhookDeliveries() int64 {
+	var count int64
+	db.Model(&WebhookDelivery{}).Where("status = ?", DeliveryPending).Count(&count)
+	return count
+}
+
+// MarkWebhookDelivered 标记投递成功
+func MarkWebhookDelivered(id uint, statusCode int) error {
+	now := time.Now()
+	return db.Model(&WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":       DeliverySucceeded,
+		"attempts":     gorm.Expr("attempts + 1"),
+		"status_code":  statusCode,
+		"last_error":   "",
+		"delivered_at": &now,
+	}).Error
+}
+
+// RetryWebhookDelivery 投递失败, at 之后重试
+func RetryWebhookDelivery(id uint, at time.Time, statusCode int, reason string) error {
+	return db.Model(&WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"attempts":        gorm.Expr("attempts + 1"),
+		"status_code":     statusCode,
+		"last_error":      reason,
+		"next_attempt_at": at,
+	}).Error
+}
+
+// FailWebhookDelivery 永久失败或重试次数用完, 不再投递
+func FailWebhookDelivery(id uint, statusCode int, reason string) error {
+	return db.Model(&WebhookDelivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      DeliveryFailed,
+		"attempts":    gorm.Expr("attempts + 1"),
+		"status_code": statusCode,
+		"last_error":  reason,
+	}).Error
+}
+
+// ListWebhookDeliveries 按时间倒序查询投递记录, webhookId 为 0 时查询所有 webhook, status 为空时不限状态
+func ListWebhookDeliveries(webhookId uint, status string, limit int) []WebhookDelivery {
+	var deliveries []WebhookDelivery
+	query := db.Order("id desc").Limit(limit)
+	if webhookId > 0 {
+		query = query.Where("webhook_id = ?", webhookId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	query.Find(&deliveries)
+	return deliveries
+}
+
+// RedeliverWebhookDeliveries 重新投递失败的记录, 返回更新的条数
+func RedeliverWebhookDeliveries(ids []uint) (int64, error) {
+	result := db.Model(&WebhookDelivery{}).Where("id IN ? AND status = ?", ids, DeliveryFailed).Updates(map[string]interface{}{
+		"status":          DeliveryPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteWebhookDeliveriesBefore 删除过期的投递记录, 待投递的保留
+func DeleteWebhookDeliveriesBefore(t time.Time) (int64, error) {
+	result := db.Where("status <> ? AND created_at < ?", DeliveryPending, t).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,92 @@
+package lib
+
+// ahoCorasick 多模式字符串匹配自动机, 按字节匹配
+type ahoCorasick struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next     map[byte]int32
+	fail     int32
+	pattern  int32 // 以该节点结尾的模式编号, 没有则为 -1
+	dictLink int32 // 沿失败链最近的带模式节点, 没有则为 -1
+}
+
+func newAhoCorasick(patterns []string) *ahoCorasick {
+	ac := &ahoCorasick{nodes: []acNode{{fail: 0, pattern: -1, dictLink: -1}}}
+	for id, p := range patterns {
+		if p == "" {
+			continue
+		}
+		cur := int32(0)
+		for i := 0; i < len(p); i++ {
+			n := &ac.nodes[cur]
+			if n.next == nil {
+				n.next = make(map[byte]int32)
+			}
+			child, ok := n.next[p[i]]
+			if !ok {
+				child = int32(len(ac.nodes))
+				n.next[p[i]] = child
+				ac.nodes = append(ac.nodes, acNode{pattern: -1, dictLink: -1})
+			}
+			cur = child
+		}
+		ac.nodes[cur].pattern = int32(id)
+	}
+
+	// 广度优先构建失败链
+	queue := make([]int32, 0, len(ac.nodes))
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[cur].next {
+			fail := ac.nodes[cur].fail
+			for {
+				if next, ok := ac.nodes[fail].next[b]; ok {
+					ac.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					ac.nodes[child].fail = 0
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			f := ac.nodes[child].fail
+			if ac.nodes[f].pattern >= 0 {
+				ac.nodes[child].dictLink = f
+			} else {
+				ac.nodes[child].dictLink = ac.nodes[f].dictLink
+			}
+			queue = append(queue, child)
+		}
+	}
+	return ac
+}
+
+// find 扫描文本, 每命中一个模式调用一次 fn, 同一模式可能被多次回调
+func (ac *ahoCorasick) find(text string, fn func(pattern int)) {
+	cur := int32(0)
+	for i := 0; i < len(text); i++ {
+		b := text[i]
+		for {
+			if next, ok := ac.nodes[cur].next[b]; ok {
+				cur = next
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = ac.nodes[cur].fail
+		}
+		for n := cur; n >= 0; n = ac.nodes[n].dictLink {
+			if ac.nodes[n].pattern >= 0 {
+				fn(int(ac.nodes[n].pattern))
+			}
+		}
+	}
+}
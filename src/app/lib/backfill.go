@@ -0,0 +1,76 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ns-rss/src/app/db"
+)
+
+const (
+	backfillFlag       = "--backfill"
+	defaultBackfill    = 24 * time.Hour // --backfill 未指定时长时回溯的时间
+	maxBackfill        = 24 * time.Hour // 最多回溯的时间
+	maxBackfillItems   = 1000           // 单次回溯最多检查的条目数
+	backfillFlagFormat = "--backfill 6h"
+)
+
+var nsFeed *NsFeed
+
+// NsFeedInstance 返回正在运行的 NsFeed, 未开启抓取时为 nil
+func NsFeedInstance() *NsFeed {
+	return nsFeed
+}
+
+// parseBackfillFlag 从 /add 参数中取出 --backfill [时长], 返回剩余参数和回溯时长
+func parseBackfillFlag(args []string) ([]string, time.Duration, error) {
+	var rest []string
+	var backfill time.Duration
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg != backfillFlag && !strings.HasPrefix(arg, backfillFlag+"=") {
+			rest = append(rest, arg)
+			continue
+		}
+
+		value := strings.TrimPrefix(strings.TrimPrefix(arg, backfillFlag), "=")
+		if value == "" && i+1 < len(args) {
+			if _, err := time.ParseDuration(args[i+1]); err == nil {
+				value = args[i+1]
+				i++
+			}
+		}
+		if value == "" {
+			backfill = defaultBackfill
+			continue
+		}
+
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return nil, 0, fmt.Errorf("回溯时长 %s 格式错误, 例如: %s", value, backfillFlagFormat)
+		}
+		if d > maxBackfill {
+			return nil, 0, fmt.Errorf("最多回溯 %v 内的帖子", maxBackfill)
+		}
+		backfill = d
+	}
+	return rest, backfill, nil
+}
+
+// Backfill 使用已保存的条目回溯新添加的关键字, 命中的条目通过通知队列发送,
+// 已通知过的链接按通知历史去重, 返回新发送的条数
+func (f *NsFeed) Backfill(chatId int64, feed db.FeedConfig, keywords []string, since time.Duration) int {
+	records := db.ListFeedItemsSince(feed.FeedId, time.Now().Add(-since), maxBackfillItems)
+
+	var matched []*feedEntry
+	for _, record := range records {
+		entry := &feedEntry{item: fromFeedItem(record)}
+		entry.doc = newMatchDoc(entry.item)
+		if _, ok := matchKeywords(entry.doc, keywords); ok {
+			matched = append(matched, entry)
+		}
+	}
+
+	return f.sendMessage(&MessageOption{ChatId: chatId, FeedId: feed.FeedId, FeedName: feed.Name}, feed.Name, matched)
+}
@@ -1,22 +1,31 @@
 package lib
 
 import (
-	"strings"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/spf13/cast"
 	"github.com/zeromicro/go-zero/core/logx"
-	"github.com/zeromicro/go-zero/core/rescue"
+
+	"ns-rss/src/app/msgfmt"
 )
 
 type NotifyMessage struct {
-	Text    string
-	ChatId  *int64
-	MsgType string //chat, group, channel
+	Text     string // msgfmt 标记格式, 见 msgfmt.Parse
+	ChatId   *int64
+	MsgType  string //chat, group, channel
+	Silent   bool   // 不发出提醒, 用于免打扰时段
+	TargetId uint   // 推送目标, 0 表示 Telegram
+	Title    string // 其它推送目标使用的标题和链接
+	Url      string
+	FeedId   string // 命中条目所属的 feed, 删除 feed 时清理未发送的消息
 }
 
 type BotNotifier interface {
-	Notify(NotifyMessage)
+	Notify(NotifyMessage) error
 }
 
 type TelegramNotifier struct {
@@ -31,45 +40,37 @@ func NewTelegramNotifier(botToken string, chatId string) *TelegramNotifier {
 	}
 }
 
-var Replacer = strings.NewReplacer("_", "\\_",
-	//"[", "\\[",
-	//"]", "\\]",
-	"(", "\\(",
-	")", "\\)",
-	//"`", "\\`",
-	//">", "\\>",
-	"#", "\\#",
-	"+", "\\+",
-	"-", "\\-",
-	"=", "\\=",
-	"|", "\\|",
-	"{", "\\{",
-	"}", "\\}",
-	".", "\\.",
-	"!", "\\!")
-
-func (t *TelegramNotifier) Notify(msg NotifyMessage) {
+func (t *TelegramNotifier) Notify(msg NotifyMessage) (err error) {
 	tg := TgBotInstance()
 	if tg == nil {
-		return
+		return errors.New("telegram bot is not ready")
 	}
 
+	// 发件箱按返回的错误判断是否发送成功, panic 需要转为错误, 否则会被当作已发送
 	defer func() {
-		rescue.Recover()
+		if r := recover(); r != nil {
+			logx.Errorw("send telegram message panic", logx.Field("panic", r), logx.Field("stack", string(debug.Stack())))
+			err = fmt.Errorf("notify panic: %v", r)
+		}
 	}()
 
-	tgMsg := tgbotapi.NewMessage(cast.ToInt64(t.chatId), Replacer.Replace(msg.Text))
+	tgMsg := tgbotapi.NewMessage(cast.ToInt64(t.chatId), msgfmt.Parse(msg.Text).MarkdownV2())
 	if msg.ChatId != nil {
 		tgMsg.ChatID = *msg.ChatId
 	}
 
 	tgMsg.ParseMode = tgbotapi.ModeMarkdownV2
 	tgMsg.DisableWebPagePreview = false
+	tgMsg.DisableNotification = msg.Silent
+	start := time.Now()
 	v, e := tg.Send(tgMsg)
+	observeTelegram("sendMessage", start, e)
 	if e != nil {
+		messagesTotal.WithLabelValues(messageFailed).Inc()
 		logx.Errorw("send telegram message failure", logx.Field("error", e), logx.Field("msg", msg.Text), logx.Field("chatId", tgMsg.ChatID))
 	} else {
+		messagesTotal.WithLabelValues(messageSent).Inc()
 		logx.Infow("send telegram message success", logx.Field("result", v.MessageID), logx.Field("msg", msg.Text), logx.Field("chatId", tgMsg.ChatID))
 	}
-
+	return e
 }
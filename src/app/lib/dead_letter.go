@@ -0,0 +1,16 @@
+package lib
+
+import "ns-rss/src/app/db"
+
+// ReplayDeadLetters 将死信重新写入发件箱并唤醒消费者, ids 为空时重新发送所有未处理的死信
+func ReplayDeadLetters(ids []uint) (int, error) {
+	n, err := db.ReplayDeadLetters(ids)
+	if err != nil {
+		return 0, err
+	}
+	messagesTotal.WithLabelValues(messageEnqueued).Add(float64(n))
+	if f := NsFeedInstance(); f != nil {
+		f.wakeOutbox()
+	}
+	return n, nil
+}
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ns-rss/src/app/db"
+	"ns-rss/src/app/msgfmt"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/rescue"
+)
+
+const (
+	digestCheckInterval    = time.Minute // 检查摘要是否到推送时间的间隔
+	maxDigestMessageLength = 3500        // 单条摘要消息的最大长度, Telegram 限制为4096, 预留转义字符的空间
+)
+
+// deliveryMode 订阅者的推送方式, 未设置时为实时推送
+func deliveryMode(sub *db.Subscribe) string {
+	if sub == nil || sub.DeliveryMode == "" {
+		return db.DeliveryInstant
+	}
+	return sub.DeliveryMode
+}
+
+// nextDigestAt 在 since 之后命中的条目下一次汇总推送的时间
+func nextDigestAt(mode, digestTime string, since time.Time, loc *time.Location) time.Time {
+	t := since.In(loc)
+	switch mode {
+	case db.DeliveryHourly:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc).Add(time.Hour)
+	case db.DeliveryDaily:
+		hour, minute, err := parseClockTime(digestTime)
+		if err != nil {
+			hour, minute, _ = parseClockTime(db.DefaultDigestTime)
+		}
+		next := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, loc)
+		if !next.After(t) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+	return since
+}
+
+// deliveryModeText 推送方式的说明
+func deliveryModeText(mode, digestTime string) string {
+	switch mode {
+	case db.DeliveryHourly:
+		return "每小时汇总推送"
+	case db.DeliveryDaily:
+		if digestTime == "" {
+			digestTime = db.DefaultDigestTime
+		}
+		return fmt.Sprintf("每天 %s 汇总推送", digestTime)
+	}
+	return "实时推送"
+}
+
+// formatDigest 将条目按 feed 分组生成摘要消息, 超过长度限制时拆分为多条
+func formatDigest(mode string, items []db.DigestItem) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	title := "免打扰期间的推送"
+	switch mode {
+	case db.DeliveryHourly:
+		title = "每小时摘要"
+	case db.DeliveryDaily:
+		title = "每日摘要"
+	}
+
+	var messages []string
+	var b strings.Builder
+	lastFeed := ""
+	for i, item := range items {
+		heading := fmt.Sprintf("\n【%s】\n", msgfmt.Escape(item.FeedName))
+		line := fmt.Sprintf("%d. %s\n👉 %s\n", i+1, msgfmt.Escape(item.Title), msgfmt.Escape(item.Url))
+		if b.Len() > 0 && b.Len()+len(heading)+len(line) > maxDigestMessageLength {
+			messages = append(messages, b.String())
+			b.Reset()
+		}
+		if b.Len() == 0 {
+			if len(messages) == 0 {
+				b.WriteString(fmt.Sprintf("📰 *%s*, 共 %d 条\n", title, len(items)))
+			} else {
+				b.WriteString(fmt.Sprintf("📰 *%s*(续)\n", title))
+			}
+			lastFeed = ""
+		}
+		// 每条消息中同一 feed 的条目只显示一次标题
+		if item.FeedName != lastFeed {
+			b.WriteString(heading)
+			lastFeed = item.FeedName
+		}
+		b.WriteString(line)
+	}
+	messages = append(messages, b.String())
+	return messages
+}
+
+// startDigestScheduler 定时汇总推送摘要
+func (f *NsFeed) startDigestScheduler() {
+	defer rescue.Recover()
+
+	tk := time.NewTicker(digestCheckInterval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-f.ctx.Done():
+			return
+		case now := <-tk.C:
+			f.flushDigests(now)
+		}
+	}
+}
+
+// flushDigests 将到推送时间的摘要写入发件箱
+func (f *NsFeed) flushDigests(now time.Time) {
+	defer rescue.Recover()
+
+	for _, chatId := range db.ListDigestChatIds() {
+		items := db.ListDigestItems(chatId)
+		if len(items) == 0 {
+			continue
+		}
+		ids := make([]uint, 0, len(items))
+		for _, item := range items {
+			ids = append(ids, item.ID)
+		}
+
+		sub := db.GetSubscribeWithChatId(chatId)
+		var messages []*db.Outbox
+		// 订阅者已关闭通知时丢弃未推送的条目
+		if sub != nil && isActiveStatus(sub.Status) {
+			mode := deliveryMode(sub)
+			if mode != db.DeliveryInstant && now.Before(nextDigestAt(mode, sub.DigestTime, items[0].CreatedAt, subscriberLocation(sub))) {
+				continue
+			}
+			// 免打扰时段内继续暂存, 结束后再推送
+			if quietHold(sub, now) {
+				continue
+			}
+			silent := quietSilent(sub, now)
+			targets := db.ListNotifyTargets(chatId, true)
+			for _, text := range formatDigest(mode, items) {
+				o := newOutbox(NotifyMessage{Text: text, ChatId: &chatId, MsgType: sub.Type, Silent: silent})
+				messages = append(messages, withTargets(o, targets, telegramEnabled(sub))...)
+			}
+		}
+
+		if err := db.FlushDigest(ids, messages); err != nil {
+			f.logger.Errorw("flush digest failed", logx.Field("err", err), logx.Field("chatId", chatId))
+			continue
+		}
+		if len(messages) > 0 {
+			messagesTotal.WithLabelValues(messageEnqueued).Add(float64(len(messages)))
+			f.logger.Infow("digest enqueued", logx.Field("chatId", chatId), logx.Field("items", len(items)))
+			f.wakeOutbox()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_nextDigestAt(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	since := time.Date(2024, 5, 1, 10, 30, 0, 0, loc)
+
+	assert.Equal(t, since, nextDigestAt(db.DeliveryInstant, "", since, loc))
+	assert.Equal(t, time.Date(2024, 5, 1, 11, 0, 0, 0, loc), nextDigestAt(db.DeliveryHourly, "", since, loc))
+	// 当天的推送时间已过, 顺延到第二天
+	assert.Equal(t, time.Date(2024, 5, 2, 9, 0, 0, 0, loc), nextDigestAt(db.DeliveryDaily, "09:00", since, loc))
+	assert.Equal(t, time.Date(2024, 5, 1, 21, 30, 0, 0, loc), nextDigestAt(db.DeliveryDaily, "21:30", since, loc))
+	// 时间格式错误时使用默认时间
+	assert.Equal(t, time.Date(2024, 5, 2, 9, 0, 0, 0, loc), nextDigestAt(db.DeliveryDaily, "bad", since, loc))
+	// 不同时区按本地时间计算
+	assert.Equal(t, time.Date(2024, 5, 1, 21, 30, 0, 0, loc), nextDigestAt(db.DeliveryDaily, "21:30", since.UTC(), loc))
+}
+
+func Test_formatDigest(t *testing.T) {
+	items := []db.DigestItem{
+		{FeedName: "NodeSeek", Title: "出 [港仔] *年付*", Url: "https://www.nodeseek.com/post-1"},
+		{FeedName: "NodeSeek", Title: "收 boil", Url: "https://www.nodeseek.com/post-2"},
+		{FeedName: "LinuxDo", Title: "话题", Url: "https://linux.do/t/1"},
+	}
+	messages := formatDigest(db.DeliveryHourly, items)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "📰 *每小时摘要*, 共 3 条\n"+
+			"\n【NodeSeek】\n1. 出 \\[港仔\\] \\*年付\\*\n👉 https://www.nodeseek.com/post-1\n"+
+			"2. 收 boil\n👉 https://www.nodeseek.com/post-2\n"+
+			"\n【LinuxDo】\n3. 话题\n👉 https://linux.do/t/1\n", messages[0])
+	}
+
+	// 超过长度限制时拆分, 每条消息都带有 feed 标题
+	items = nil
+	for i := 0; i < 100; i++ {
+		items = append(items, db.DigestItem{FeedName: "NodeSeek", Title: strings.Repeat("标题", 10), Url: fmt.Sprintf("https://www.nodeseek.com/post-%d", i)})
+	}
+	messages = formatDigest(db.DeliveryDaily, items)
+	assert.Greater(t, len(messages), 1)
+	for i, msg := range messages {
+		assert.LessOrEqual(t, len(msg), maxDigestMessageLength)
+		assert.Contains(t, msg, "【NodeSeek】")
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(msg, "📰 *每日摘要*(续)"))
+		}
+	}
+	assert.Contains(t, messages[len(messages)-1], "100. ")
+}
@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/imroc/req/v3"
+	"github.com/mmcdole/gofeed"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// errNotModified 源站返回 304, 内容没有变化
+var errNotModified = errors.New("feed not modified")
+
+// feedClient 每个 feed 复用的 http 客户端, 保存条件请求所需的 ETag/Last-Modified
+type feedClient struct {
+	mu           sync.Mutex
+	client       *req.Client
+	url          string
+	settingsKey  string // 抓取设置变更后重新创建客户端
+	etag         string
+	lastModified string
+}
+
+var feedClients sync.Map // feedId -> *feedClient
+
+// feedClientKey 影响 http 客户端的抓取设置
+func feedClientKey(feed *db.FeedConfig, timeout time.Duration) string {
+	return strings.Join([]string{feed.FeedUrl, feed.Headers, feed.Cookies, feed.Proxy, feed.Impersonate, timeout.String()}, "\n")
+}
+
+func newFeedClient(feed *db.FeedConfig, timeout time.Duration) (*feedClient, error) {
+	client := req.C().SetTimeout(timeout)
+	switch feed.Impersonate {
+	case db.ImpersonateOff:
+	case db.ImpersonateFirefox:
+		client.ImpersonateFirefox()
+	case db.ImpersonateSafari:
+		client.ImpersonateSafari()
+	default:
+		client.ImpersonateChrome()
+	}
+	if len(feed.HeadersMap) > 0 {
+		client.SetCommonHeaders(feed.HeadersMap)
+	}
+	if feed.Cookies != "" {
+		client.SetCommonHeader("Cookie", feed.Cookies)
+	}
+	if feed.Proxy != "" {
+		proxy, err := url.Parse(feed.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		client.SetProxy(http.ProxyURL(proxy))
+	}
+	return &feedClient{client: client, url: feed.FeedUrl, settingsKey: feedClientKey(feed, timeout)}, nil
+}
+
+// getFeedClient 获取 feed 的客户端, 首次使用时从数据库恢复验证信息
+func getFeedClient(feed *db.FeedConfig, timeout time.Duration) (*feedClient, error) {
+	key := feedClientKey(feed, timeout)
+	var old *feedClient
+	if v, ok := feedClients.Load(feed.FeedId); ok {
+		old = v.(*feedClient)
+		if old.settingsKey == key {
+			return old, nil
+		}
+	}
+
+	c, err := newFeedClient(feed, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if old != nil && old.url == feed.FeedUrl {
+		state := old.state(feed.FeedId)
+		c.etag, c.lastModified = state.ETag, state.LastModified
+	} else if state := db.GetFeedState(feed.FeedId); state.ID > 0 && state.FeedUrl == feed.FeedUrl {
+		c.etag, c.lastModified = state.ETag, state.LastModified
+	}
+	feedClients.Store(feed.FeedId, c)
+	return c, nil
+}
+
+// fetch 发起条件请求, 返回 http 状态码, 网络错误时为 0
+// 内容未变化时返回 errNotModified, changed 表示验证信息是否有更新
+func (c *feedClient) fetch(ctx context.Context) (feed *gofeed.Feed, status int, changed bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := c.client.R().SetContext(ctx)
+	if c.etag != "" {
+		r.SetHeader("If-None-Match", c.etag)
+	}
+	if c.lastModified != "" {
+		r.SetHeader("If-Modified-Since", c.lastModified)
+	}
+	resp, err := r.Get(c.url)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	status = resp.StatusCode
+	if status == http.StatusNotModified {
+		return nil, status, false, errNotModified
+	}
+	if resp.IsErrorState() {
+		return nil, status, false, fmt.Errorf("unexpected status code %d", status)
+	}
+
+	feed, err = gofeed.NewParser().ParseString(resp.String())
+	if err != nil {
+		return nil, status, false, err
+	}
+
+	// 只在解析成功后更新验证信息, 避免缓存错误的内容
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != c.etag || lastModified != c.lastModified {
+		c.etag, c.lastModified = etag, lastModified
+		changed = true
+	}
+	return feed, status, changed, nil
+}
+
+func (c *feedClient) state(feedId string) db.FeedState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return db.FeedState{FeedId: feedId, FeedUrl: c.url, ETag: c.etag, LastModified: c.lastModified}
+}
+
+// loadRssData 抓取 feed, 返回 http 状态码, 内容未变化时返回 errNotModified
+func (f *NsFeed) loadRssData(feed *db.FeedConfig, ctx context.Context) (*gofeed.Feed, int, error) {
+	c, err := getFeedClient(feed, feedFetchSettings(feed, f.Config).timeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, status, changed, err := c.fetch(ctx)
+	if err != nil {
+		return nil, status, err
+	}
+	if changed {
+		if err := db.SaveFeedState(c.state(feed.FeedId)); err != nil {
+			logx.Errorw("save feed state failed", logx.Field("err", err), logx.Field("feedId", feed.FeedId))
+		}
+	}
+	return resp, status, nil
+}
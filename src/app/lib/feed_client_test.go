@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRss = `<?xml version="1.0"?><rss version="2.0"><channel><title>ns</title>
+<item><title>出港仔</title><link>https://www.nodeseek.com/post-1-1</link></item>
+</channel></rss>`
+
+func Test_feedClientConditionalGet(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = w.Write([]byte(testRss))
+	}))
+	defer server.Close()
+
+	c, err := newFeedClient(&db.FeedConfig{FeedUrl: server.URL}, time.Second)
+	assert.NoError(t, err)
+	feed, status, changed, err := c.fetch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+	assert.True(t, changed)
+	assert.Len(t, feed.Items, 1)
+	assert.Equal(t, `"v1"`, c.state("ns").ETag)
+
+	_, status, changed, err = c.fetch(context.Background())
+	assert.ErrorIs(t, err, errNotModified)
+	assert.Equal(t, http.StatusNotModified, status)
+	assert.False(t, changed)
+	assert.Equal(t, 2, requests)
+}
+
+func Test_feedClientErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c, err := newFeedClient(&db.FeedConfig{FeedUrl: server.URL}, time.Second)
+	assert.NoError(t, err)
+	_, status, _, err := c.fetch(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.Empty(t, c.state("ns").ETag)
+}
@@ -0,0 +1,190 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ns-rss/src/app/config"
+	"ns-rss/src/app/db"
+	"ns-rss/src/app/msgfmt"
+
+	"github.com/golang-module/carbon/v2"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// defaultFeedFailureThreshold 连续失败多少次后通知管理员
+const defaultFeedFailureThreshold = 5
+
+// maxFeedErrorLength 保存和展示的错误信息最大长度
+const maxFeedErrorLength = 200
+
+var feedHealth *FeedHealth
+
+func init() {
+	feedHealth = NewFeedHealth()
+}
+
+func FeedHealthInstance() *FeedHealth {
+	return feedHealth
+}
+
+// FeedHealth 记录每个 feed 的抓取健康状态, 启动时从数据库恢复
+type FeedHealth struct {
+	mu     sync.Mutex
+	loaded bool
+	states map[string]*db.FeedState
+	// save 持久化健康状态, 测试中可替换
+	save func(state db.FeedState) error
+}
+
+func NewFeedHealth() *FeedHealth {
+	return &FeedHealth{
+		states: make(map[string]*db.FeedState),
+		save:   db.SaveFeedHealth,
+	}
+}
+
+// healthChange 本次抓取后健康状态的变化
+type healthChange int
+
+const (
+	healthUnchanged healthChange = iota
+	healthAlert                  // 连续失败次数达到阈值
+	healthRecovered              // 告警后恢复
+)
+
+func feedFailureThreshold(c *config.Config) int {
+	if c == nil || c.FeedFailureThreshold <= 0 {
+		return defaultFeedFailureThreshold
+	}
+	return c.FeedFailureThreshold
+}
+
+// load 需要持有锁
+func (h *FeedHealth) load() {
+	if h.loaded {
+		return
+	}
+	h.loaded = true
+	for _, state := range db.ListFeedStates() {
+		state := state
+		h.states[state.FeedId] = &state
+	}
+}
+
+// state 需要持有锁
+func (h *FeedHealth) state(feed *db.FeedConfig) *db.FeedState {
+	h.load()
+	s, ok := h.states[feed.FeedId]
+	if !ok {
+		s = &db.FeedState{FeedId: feed.FeedId}
+		h.states[feed.FeedId] = s
+	}
+	s.FeedUrl = feed.FeedUrl
+	return s
+}
+
+// record 记录一次抓取结果, 返回是否需要告警或发送恢复通知
+func (h *FeedHealth) record(feed *db.FeedConfig, status int, itemCount int, err error, threshold int) (db.FeedState, healthChange) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.state(feed)
+	now := time.Now()
+	s.LastStatus = status
+	change := healthUnchanged
+	if err != nil {
+		msg := []rune(err.Error())
+		if len(msg) > maxFeedErrorLength {
+			msg = msg[:maxFeedErrorLength]
+		}
+		s.LastErrorAt = &now
+		s.LastError = string(msg)
+		s.ConsecutiveFailures++
+		if s.ConsecutiveFailures >= threshold && !s.Alerting {
+			s.Alerting = true
+			change = healthAlert
+		}
+	} else {
+		s.LastSuccessAt = &now
+		s.LastItemCount = itemCount
+		s.ConsecutiveFailures = 0
+		if s.Alerting {
+			s.Alerting = false
+			change = healthRecovered
+		}
+	}
+
+	if err := h.save(*s); err != nil {
+		logx.Errorw("save feed health failed", logx.Field("err", err), logx.Field("feedId", feed.FeedId))
+	}
+	return *s, change
+}
+
+// setInterval 更新当前抓取间隔, 下次记录抓取结果时持久化
+func (h *FeedHealth) setInterval(feed *db.FeedConfig, interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state(feed).Interval = int64(interval / time.Second)
+}
+
+// remove 删除 feed 的健康状态
+func (h *FeedHealth) remove(feedId string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.states, feedId)
+}
+
+// Get 返回 feed 的健康状态
+func (h *FeedHealth) Get(feedId string) (db.FeedState, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.load()
+	s, ok := h.states[feedId]
+	if !ok {
+		return db.FeedState{FeedId: feedId}, false
+	}
+	return *s, true
+}
+
+// recordHealth 记录抓取结果, 故障达到阈值或恢复时通知管理员
+func (f *NsFeed) recordHealth(feed *db.FeedConfig, status int, itemCount int, err error) {
+	state, change := FeedHealthInstance().record(feed, status, itemCount, err, feedFailureThreshold(f.Config))
+	if change == healthUnchanged || f.bot == nil {
+		return
+	}
+
+	var text string
+	switch change {
+	case healthAlert:
+		text = fmt.Sprintf("⚠️ RSS源 %s(%s) 连续抓取失败 %d 次\n状态码: %d\n错误: %s",
+			feed.Name, feed.FeedId, state.ConsecutiveFailures, state.LastStatus, state.LastError)
+	case healthRecovered:
+		text = fmt.Sprintf("✅ RSS源 %s(%s) 已恢复, 本次抓取 %d 条", feed.Name, feed.FeedId, state.LastItemCount)
+	}
+	f.bot.Notify(NotifyMessage{Text: msgfmt.Text(text).String()})
+}
+
+// feedHealthText 生成 /status 中各 feed 的健康状态, 纯文本
+func feedHealthText() string {
+	var lines []string
+	for _, feed := range FeedRegistryInstance().List() {
+		state, ok := FeedHealthInstance().Get(feed.FeedId)
+		name := fmt.Sprintf("%s(%s)", feed.Name, feed.FeedId)
+		switch {
+		case feed.Paused:
+			lines = append(lines, fmt.Sprintf("⏸ %s 已暂停", name))
+		case !ok || (state.LastSuccessAt == nil && state.LastErrorAt == nil):
+			lines = append(lines, fmt.Sprintf("⚪ %s 暂无抓取记录", name))
+		case state.ConsecutiveFailures > 0:
+			lines = append(lines, fmt.Sprintf("🔴 %s 连续失败 %d 次, 状态码 %d, 间隔 %ds\n    %s",
+				name, state.ConsecutiveFailures, state.LastStatus, state.Interval, state.LastError))
+		default:
+			lines = append(lines, fmt.Sprintf("🟢 %s %s 抓取 %d 条, 间隔 %ds",
+				name, carbon.CreateFromStdTime(*state.LastSuccessAt).ToTimeString(), state.LastItemCount, state.Interval))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
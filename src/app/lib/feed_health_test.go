@@ -0,0 +1,55 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedHealth_record(t *testing.T) {
+	h := NewFeedHealth()
+	h.loaded = true
+	var saved []db.FeedState
+	h.save = func(state db.FeedState) error {
+		saved = append(saved, state)
+		return nil
+	}
+
+	feed := &db.FeedConfig{FeedId: "ns", FeedUrl: "https://rss.nodeseek.com"}
+	h.setInterval(feed, 20*time.Second)
+
+	state, change := h.record(feed, 200, 30, nil, 3)
+	assert.Equal(t, healthUnchanged, change)
+	assert.Equal(t, 30, state.LastItemCount)
+	assert.Equal(t, int64(20), state.Interval)
+	assert.NotNil(t, state.LastSuccessAt)
+
+	cf := errors.New("unexpected status code 403")
+	for i := 1; i < 3; i++ {
+		_, change = h.record(feed, 403, 0, cf, 3)
+		assert.Equal(t, healthUnchanged, change)
+	}
+	state, change = h.record(feed, 403, 0, cf, 3)
+	assert.Equal(t, healthAlert, change)
+	assert.Equal(t, 3, state.ConsecutiveFailures)
+	assert.Equal(t, 403, state.LastStatus)
+	assert.Equal(t, cf.Error(), state.LastError)
+
+	// 告警后继续失败不重复通知
+	_, change = h.record(feed, 0, 0, cf, 3)
+	assert.Equal(t, healthUnchanged, change)
+
+	state, change = h.record(feed, 200, 10, nil, 3)
+	assert.Equal(t, healthRecovered, change)
+	assert.Equal(t, 0, state.ConsecutiveFailures)
+	assert.False(t, state.Alerting)
+	assert.Len(t, saved, 6)
+
+	got, ok := h.Get("ns")
+	assert.True(t, ok)
+	assert.Equal(t, 10, got.LastItemCount)
+}
@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"strings"
+	"time"
+
+	"ns-rss/src/app/config"
+	"ns-rss/src/app/db"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/rescue"
+)
+
+const (
+	defaultFeedItemRetention  = 7 * 24 * time.Hour // 默认保留 7 天
+	defaultFeedItemMaxPerFeed = 5000               // 默认每个 feed 最多保留的条目数
+	maxFeedItemDescription    = 4000               // 正文最多保存的字符数
+	feedItemCleanupInterval   = time.Hour
+)
+
+// feedItemRetention 读取条目保留时长, 配置为 0 时不按时间清理
+func feedItemRetention(c *config.Config) time.Duration {
+	if c == nil || c.FeedItemRetention == "" {
+		return defaultFeedItemRetention
+	}
+	d, err := time.ParseDuration(c.FeedItemRetention)
+	if err != nil || d < 0 {
+		logx.Errorw("parse feedItemRetention failed", logx.Field("err", err), logx.Field("feedItemRetention", c.FeedItemRetention))
+		return defaultFeedItemRetention
+	}
+	return d
+}
+
+// feedItemMaxPerFeed 读取每个 feed 保留的条目数, 配置为负数时不限制
+func feedItemMaxPerFeed(c *config.Config) int {
+	if c == nil || c.FeedItemMaxPerFeed == 0 {
+		return defaultFeedItemMaxPerFeed
+	}
+	return c.FeedItemMaxPerFeed
+}
+
+// toFeedItem 将 RSS 条目转为数据库记录, guid 为空时使用去除锚点后的链接
+func toFeedItem(feedId string, item *gofeed.Item, seen time.Time) *db.FeedItem {
+	link, err := removeHash(item.Link)
+	if err != nil {
+		link = item.Link
+	}
+	guid := item.GUID
+	if guid == "" {
+		guid = link
+	}
+
+	desc := []rune(stripHTML(item.Description + "\n" + item.Content))
+	if len(desc) > maxFeedItemDescription {
+		desc = desc[:maxFeedItemDescription]
+	}
+
+	var authors []string
+	if item.Author != nil && item.Author.Name != "" {
+		authors = append(authors, item.Author.Name)
+	}
+	for _, a := range item.Authors {
+		if a != nil && a.Name != "" && (item.Author == nil || a.Name != item.Author.Name) {
+			authors = append(authors, a.Name)
+		}
+	}
+
+	published := item.PublishedParsed
+	if published == nil {
+		published = item.UpdatedParsed
+	}
+
+	return &db.FeedItem{
+		FeedId:          feedId,
+		Guid:            guid,
+		Url:             link,
+		Title:           item.Title,
+		Description:     string(desc),
+		Author:          strings.Join(authors, ", "),
+		CategoriesArray: item.Categories,
+		PublishedAt:     published,
+		FirstSeenAt:     seen,
+	}
+}
+
+// fromFeedItem 将数据库记录还原为 RSS 条目, 用于关键字匹配
+func fromFeedItem(item *db.FeedItem) *gofeed.Item {
+	v := &gofeed.Item{
+		GUID:            item.Guid,
+		Link:            item.Url,
+		Title:           item.Title,
+		Description:     item.Description,
+		Categories:      item.CategoriesArray,
+		PublishedParsed: item.PublishedAt,
+	}
+	if v.PublishedParsed == nil {
+		seen := item.FirstSeenAt
+		v.PublishedParsed = &seen
+	}
+	published := v.PublishedParsed.UTC()
+	v.PublishedParsed = &published
+	if item.Author != "" {
+		v.Author = &gofeed.Person{Name: item.Author}
+	}
+	return v
+}
+
+// storeFeedItems 保存本次抓取到的条目, 已存在的条目保持首次抓取时间不变
+func storeFeedItems(feedId string, items []*gofeed.Item) {
+	now := time.Now()
+	records := make([]*db.FeedItem, 0, len(items))
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		records = append(records, toFeedItem(feedId, item, now))
+	}
+	if _, err := db.SaveFeedItems(records); err != nil {
+		logx.Errorw("save feed items failed", logx.Field("err", err), logx.Field("feedId", feedId))
+	}
+}
+
+// loadRecentItems 启动时从数据库恢复最近条目, 重启后 /test 仍可使用
+func loadRecentItems() {
+	for _, feed := range db.ListAllFeedConfig() {
+		records := db.ListRecentFeedItems(feed.FeedId, recentItemsSize)
+		items := make([]*gofeed.Item, 0, len(records))
+		for _, record := range records {
+			items = append(items, fromFeedItem(record))
+		}
+		RecentItemsInstance().Add(feed.FeedId, items)
+	}
+}
+
+// cleanupFeedItems 按保留时长和数量清理过期条目
+func (f *NsFeed) cleanupFeedItems() {
+	defer rescue.Recover()
+
+	if retention := feedItemRetention(f.Config); retention > 0 {
+		n, err := db.DeleteFeedItemsBefore(time.Now().Add(-retention))
+		if err != nil {
+			f.logger.Errorw("delete expired feed items failed", logx.Field("err", err))
+		} else if n > 0 {
+			f.logger.Infow("delete expired feed items", logx.Field("count", n))
+		}
+	}
+
+	if keep := feedItemMaxPerFeed(f.Config); keep > 0 {
+		for _, feed := range db.ListAllFeedConfig() {
+			n, err := db.TrimFeedItems(feed.FeedId, keep)
+			if err != nil {
+				f.logger.Errorw("trim feed items failed", logx.Field("err", err), logx.Field("feedId", feed.FeedId))
+			} else if n > 0 {
+				f.logger.Infow("trim feed items", logx.Field("count", n), logx.Field("feedId", feed.FeedId))
+			}
+		}
+	}
+
+	f.cleanupOutbox()
+	f.cleanupWebhookDeliveries()
+}
+
+// startFeedItemCleanup 定时清理历史条目
+func (f *NsFeed) startFeedItemCleanup() {
+	go func() {
+		defer rescue.Recover()
+
+		f.cleanupFeedItems()
+		tk := time.NewTicker(feedItemCleanupInterval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-tk.C:
+				f.cleanupFeedItems()
+			}
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_toFeedItem(t *testing.T) {
+	published := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	seen := time.Now()
+	item := &gofeed.Item{
+		Title:           "出港仔",
+		Link:            "https://www.nodeseek.com/post-1-1#reply",
+		Description:     "<p>便宜&amp;好用</p>",
+		Author:          &gofeed.Person{Name: "alice"},
+		Authors:         []*gofeed.Person{{Name: "alice"}, {Name: "bob"}},
+		Categories:      []string{"trade"},
+		PublishedParsed: &published,
+	}
+
+	record := toFeedItem("ns", item, seen)
+	assert.Equal(t, "https://www.nodeseek.com/post-1-1", record.Url)
+	assert.Equal(t, record.Url, record.Guid)
+	assert.Equal(t, "便宜&好用", record.Description)
+	assert.Equal(t, "alice, bob", record.Author)
+	assert.Equal(t, []string{"trade"}, record.CategoriesArray)
+	assert.Equal(t, &published, record.PublishedAt)
+	assert.Equal(t, seen, record.FirstSeenAt)
+
+	restored := fromFeedItem(record)
+	_, ok := matchKeywords(newMatchDoc(restored), []string{"desc:好用 author:bob cat:trade"})
+	assert.True(t, ok)
+}
+
+func Test_parseBackfillFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantArgs []string
+		want     time.Duration
+		wantErr  bool
+	}{
+		{name: "未指定", args: []string{"港仔"}, wantArgs: []string{"港仔"}},
+		{name: "指定时长", args: []string{"--backfill", "6h", "港仔"}, wantArgs: []string{"港仔"}, want: 6 * time.Hour},
+		{name: "等号写法", args: []string{"港仔", "--backfill=30m"}, wantArgs: []string{"港仔"}, want: 30 * time.Minute},
+		{name: "默认时长", args: []string{"--backfill", "港仔"}, wantArgs: []string{"港仔"}, want: defaultBackfill},
+		{name: "超过上限", args: []string{"--backfill", "48h", "港仔"}, wantErr: true},
+		{name: "格式错误", args: []string{"--backfill=abc", "港仔"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, d, err := parseBackfillFlag(tt.args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantArgs, args)
+			assert.Equal(t, tt.want, d)
+		})
+	}
+}
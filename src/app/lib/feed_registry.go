@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/rescue"
+	"github.com/zeromicro/go-zero/core/threading"
+)
+
+// FeedEvent feed 列表的变更类型
+type FeedEvent int
+
+const (
+	FeedAdded FeedEvent = iota
+	FeedUpdated
+	FeedRemoved
+)
+
+func (e FeedEvent) String() string {
+	switch e {
+	case FeedAdded:
+		return "added"
+	case FeedUpdated:
+		return "updated"
+	case FeedRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// FeedListener feed 变更的回调, 在 Reload 的调用协程中执行
+type FeedListener func(event FeedEvent, feed db.FeedConfig)
+
+// feedReloadInterval 定时从数据库同步 feed 列表, 兼容直接修改数据库的情况
+const feedReloadInterval = time.Minute
+
+var feedRegistry *FeedRegistry
+
+func init() {
+	feedRegistry = NewFeedRegistry()
+}
+
+func FeedRegistryInstance() *FeedRegistry {
+	return feedRegistry
+}
+
+// FeedRegistry 当前生效的 feed 列表, 抓取调度和 Telegram 菜单订阅它的变更
+type FeedRegistry struct {
+	mu        sync.RWMutex
+	feeds     map[string]db.FeedConfig
+	listeners []FeedListener
+}
+
+func NewFeedRegistry() *FeedRegistry {
+	return &FeedRegistry{feeds: make(map[string]db.FeedConfig)}
+}
+
+// Subscribe 注册变更回调
+func (r *FeedRegistry) Subscribe(l FeedListener) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, l)
+}
+
+// List 返回所有 feed, 按添加顺序排列
+func (r *FeedRegistry) List() []db.FeedConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	feeds := make([]db.FeedConfig, 0, len(r.feeds))
+	for _, feed := range r.feeds {
+		feeds = append(feeds, feed)
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].ID < feeds[j].ID
+	})
+	return feeds
+}
+
+func (r *FeedRegistry) Get(feedId string) (db.FeedConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	feed, ok := r.feeds[feedId]
+	return feed, ok
+}
+
+// Reload 从数据库同步 feed 列表并通知变更
+func (r *FeedRegistry) Reload() {
+	r.Apply(db.ListAllFeedConfig())
+}
+
+// Apply 使用给定的 feed 列表替换当前列表并通知变更
+func (r *FeedRegistry) Apply(feeds []db.FeedConfig) {
+	type change struct {
+		event FeedEvent
+		feed  db.FeedConfig
+	}
+	var changes []change
+
+	r.mu.Lock()
+	latest := make(map[string]db.FeedConfig, len(feeds))
+	for _, feed := range feeds {
+		latest[feed.FeedId] = feed
+		old, ok := r.feeds[feed.FeedId]
+		if !ok {
+			changes = append(changes, change{event: FeedAdded, feed: feed})
+		} else if !reflect.DeepEqual(old, feed) {
+			changes = append(changes, change{event: FeedUpdated, feed: feed})
+		}
+	}
+	for feedId, feed := range r.feeds {
+		if _, ok := latest[feedId]; !ok {
+			changes = append(changes, change{event: FeedRemoved, feed: feed})
+		}
+	}
+	r.feeds = latest
+	listeners := make([]FeedListener, len(r.listeners))
+	copy(listeners, r.listeners)
+	r.mu.Unlock()
+
+	for _, c := range changes {
+		logx.Infow("feed changed", logx.Field("event", c.event.String()), logx.Field("feedId", c.feed.FeedId))
+		for _, l := range listeners {
+			func() {
+				defer rescue.Recover()
+				l(c.event, c.feed)
+			}()
+		}
+	}
+}
+
+// DeleteFeed 删除 feed 并级联删除订阅、webhook 和未发送的消息, 通知受影响的用户其关键字已被移除
+func DeleteFeed(feedId string) error {
+	feed := db.GetFeedConfigWithFeedId(feedId)
+	if feed.ID == 0 {
+		return errors.New("未找到该feed")
+	}
+
+	subs := db.ListSubscribeConfigWithFeedId(feedId)
+	if err := db.DeleteFeedConfig(feedId); err != nil {
+		return err
+	}
+	MatcherRegistryInstance().Invalidate(feedId)
+	WebhookRegistryInstance().Invalidate()
+	RecentItemsInstance().Remove(feedId)
+	feedClients.Delete(feedId)
+	FeedHealthInstance().remove(feedId)
+	FeedRegistryInstance().Reload()
+
+	threading.GoSafe(func() {
+		for _, sub := range subs {
+			if len(sub.KeywordsArray) == 0 {
+				continue
+			}
+			notifyFeedRemoved(sub.ChatId, feed, sub.KeywordsArray)
+		}
+	})
+	return nil
+}
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"fmt"
+	"testing"
+
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeedRegistry_Apply(t *testing.T) {
+	r := NewFeedRegistry()
+	var events []string
+	r.Subscribe(func(event FeedEvent, feed db.FeedConfig) {
+		events = append(events, fmt.Sprintf("%s:%s", event, feed.FeedId))
+	})
+
+	ns := db.FeedConfig{ID: 1, FeedId: "ns", FeedUrl: "https://rss.nodeseek.com"}
+	linux := db.FeedConfig{ID: 2, FeedId: "linux", FeedUrl: "https://linux.do/latest.rss"}
+	r.Apply([]db.FeedConfig{linux, ns})
+	assert.ElementsMatch(t, []string{"added:ns", "added:linux"}, events)
+	assert.Equal(t, []string{"ns", "linux"}, []string{r.List()[0].FeedId, r.List()[1].FeedId})
+
+	// 没有变化时不通知
+	events = nil
+	r.Apply([]db.FeedConfig{ns, linux})
+	assert.Empty(t, events)
+
+	ns.MinInterval = "30s"
+	r.Apply([]db.FeedConfig{ns})
+	assert.ElementsMatch(t, []string{"updated:ns", "removed:linux"}, events)
+
+	feed, ok := r.Get("ns")
+	assert.True(t, ok)
+	assert.Equal(t, "30s", feed.MinInterval)
+	_, ok = r.Get("linux")
+	assert.False(t, ok)
+}
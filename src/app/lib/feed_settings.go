@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"ns-rss/src/app/config"
+	"ns-rss/src/app/db"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	minFetchInterval        = 10 * time.Second // 抓取间隔下限
+	defaultMaxFetchInterval = 5 * time.Minute
+	defaultFetchTimeout     = 30 * time.Second
+	maxFetchTimeout         = 2 * time.Minute
+)
+
+// fetchSettings feed 的抓取间隔和超时时间
+type fetchSettings struct {
+	minInterval time.Duration
+	maxInterval time.Duration
+	timeout     time.Duration
+}
+
+// defaultFetchInterval 配置文件 fetchTimeInterval 作为默认的最小抓取间隔, 不小于10s
+func defaultFetchInterval(c *config.Config) time.Duration {
+	if c == nil || c.FetchTimeInterval == "" {
+		return minFetchInterval
+	}
+	d, err := time.ParseDuration(c.FetchTimeInterval)
+	if err != nil {
+		logx.Errorw("parse duration failed", logx.Field("err", err), logx.Field("FetchTimeInterval", c.FetchTimeInterval))
+		return minFetchInterval
+	}
+	if d < minFetchInterval {
+		return minFetchInterval
+	}
+	return d
+}
+
+func parseDurationOr(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// feedFetchSettings 读取 feed 的抓取设置, 未设置或无效的值使用默认值
+func feedFetchSettings(feed *db.FeedConfig, c *config.Config) fetchSettings {
+	s := fetchSettings{
+		minInterval: parseDurationOr(feed.MinInterval, defaultFetchInterval(c)),
+		maxInterval: parseDurationOr(feed.MaxInterval, defaultMaxFetchInterval),
+		timeout:     parseDurationOr(feed.Timeout, defaultFetchTimeout),
+	}
+	if s.minInterval < minFetchInterval {
+		s.minInterval = minFetchInterval
+	}
+	if s.maxInterval < s.minInterval {
+		s.maxInterval = s.minInterval
+	}
+	if s.timeout > maxFetchTimeout {
+		s.timeout = maxFetchTimeout
+	}
+	return s
+}
+
+// ValidateFeedConfig 检查 feed 的抓取设置
+func ValidateFeedConfig(feed db.FeedConfig) error {
+	if feed.FeedId == "" {
+		return fmt.Errorf("feed_id 不能为空")
+	}
+	if u, err := url.Parse(feed.FeedUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("feed_url %s 格式错误", feed.FeedUrl)
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{name: "min_interval", value: feed.MinInterval, min: minFetchInterval},
+		{name: "max_interval", value: feed.MaxInterval, min: minFetchInterval},
+		{name: "timeout", value: feed.Timeout, min: time.Second, max: maxFetchTimeout},
+	}
+	for _, v := range durations {
+		if v.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v.value)
+		if err != nil {
+			return fmt.Errorf("%s %s 格式错误, 例如: 30s、5m", v.name, v.value)
+		}
+		if d < v.min {
+			return fmt.Errorf("%s 不能小于 %v", v.name, v.min)
+		}
+		if v.max > 0 && d > v.max {
+			return fmt.Errorf("%s 不能大于 %v", v.name, v.max)
+		}
+	}
+	if feed.MinInterval != "" && feed.MaxInterval != "" {
+		minInterval, _ := time.ParseDuration(feed.MinInterval)
+		maxInterval, _ := time.ParseDuration(feed.MaxInterval)
+		if maxInterval < minInterval {
+			return fmt.Errorf("max_interval 不能小于 min_interval")
+		}
+	}
+
+	if feed.Template != "" {
+		if err := ValidateMessageTemplate(feed.Template); err != nil {
+			return fmt.Errorf("template %v", err)
+		}
+	}
+
+	if feed.Proxy != "" {
+		u, err := url.Parse(feed.Proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("proxy %s 格式错误", feed.Proxy)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("proxy 只支持 http、https、socks5 代理")
+		}
+	}
+
+	switch feed.Impersonate {
+	case "", db.ImpersonateChrome, db.ImpersonateFirefox, db.ImpersonateSafari, db.ImpersonateOff:
+	default:
+		return fmt.Errorf("impersonate 只支持 %s、%s、%s、%s", db.ImpersonateChrome, db.ImpersonateFirefox, db.ImpersonateSafari, db.ImpersonateOff)
+	}
+
+	for k := range feed.HeadersMap {
+		if strings.TrimSpace(k) == "" || strings.ContainsAny(k, " :\r\n") {
+			return fmt.Errorf("请求头 %q 格式错误", k)
+		}
+	}
+	if strings.ContainsAny(feed.Cookies, "\r\n") {
+		return fmt.Errorf("cookies 格式错误")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"ns-rss/src/app/config"
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_feedFetchSettings(t *testing.T) {
+	c := &config.Config{FetchTimeInterval: "30s"}
+
+	s := feedFetchSettings(&db.FeedConfig{}, c)
+	assert.Equal(t, fetchSettings{minInterval: 30 * time.Second, maxInterval: defaultMaxFetchInterval, timeout: defaultFetchTimeout}, s)
+
+	s = feedFetchSettings(&db.FeedConfig{MinInterval: "1m", MaxInterval: "30s", Timeout: "10s"}, c)
+	assert.Equal(t, fetchSettings{minInterval: time.Minute, maxInterval: time.Minute, timeout: 10 * time.Second}, s)
+
+	assert.Equal(t, minFetchInterval, defaultFetchInterval(&config.Config{FetchTimeInterval: "1s"}))
+	assert.Equal(t, minFetchInterval, defaultFetchInterval(nil))
+}
+
+func TestValidateFeedConfig(t *testing.T) {
+	base := db.FeedConfig{FeedId: "ns", FeedUrl: "https://rss.nodeseek.com"}
+	tests := []struct {
+		name    string
+		modify  func(f *db.FeedConfig)
+		wantErr bool
+	}{
+		{name: "默认设置", modify: func(f *db.FeedConfig) {}},
+		{name: "完整设置", modify: func(f *db.FeedConfig) {
+			f.MinInterval, f.MaxInterval, f.Timeout = "30s", "10m", "15s"
+			f.HeadersMap = map[string]string{"Referer": "https://www.nodeseek.com"}
+			f.Proxy, f.Impersonate = "socks5://127.0.0.1:1080", db.ImpersonateOff
+		}},
+		{name: "地址错误", modify: func(f *db.FeedConfig) { f.FeedUrl = "rss.nodeseek.com" }, wantErr: true},
+		{name: "间隔过小", modify: func(f *db.FeedConfig) { f.MinInterval = "1s" }, wantErr: true},
+		{name: "间隔格式错误", modify: func(f *db.FeedConfig) { f.MaxInterval = "5" }, wantErr: true},
+		{name: "最大间隔小于最小间隔", modify: func(f *db.FeedConfig) { f.MinInterval, f.MaxInterval = "5m", "1m" }, wantErr: true},
+		{name: "超时过长", modify: func(f *db.FeedConfig) { f.Timeout = "10m" }, wantErr: true},
+		{name: "代理协议错误", modify: func(f *db.FeedConfig) { f.Proxy = "ftp://127.0.0.1" }, wantErr: true},
+		{name: "指纹错误", modify: func(f *db.FeedConfig) { f.Impersonate = "edge" }, wantErr: true},
+		{name: "请求头错误", modify: func(f *db.FeedConfig) { f.HeadersMap = map[string]string{"X Bad": "1"} }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feed := base
+			tt.modify(&feed)
+			err := ValidateFeedConfig(feed)
+			assert.Equal(t, tt.wantErr, err != nil, "err = %v", err)
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 关键字表达式语法:
+//
+//	expr    := or
+//	or      := and { (OR | "|") and }
+//	and     := unary { [AND | "+"] unary }   相邻的两个关键字默认为与
+//	unary   := (NOT | "~") unary | primary
+//	primary := [FIELD ":"] (WORD | "短语" | "(" expr ")")
+//
+// 优先级 NOT > AND > OR, 运算符 AND/OR/NOT 需大写。
+// "a~b" 与 "a NOT b" 等价于 "a AND NOT b"。
+// FIELD 指定匹配的字段(title/desc/author/cat), 默认匹配标题。
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+	tokField
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 从1开始的字符位置
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "结尾"
+	case tokPhrase:
+		return `"` + t.text + `"`
+	case tokField:
+		return t.text + ":"
+	default:
+		return t.text
+	}
+}
+
+// ExprError 关键字表达式语法错误
+type ExprError struct {
+	Expr string
+	Pos  int // 出错位置, 从1开始按字符计数
+	Msg  string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("关键字 %s 第%d个字符处%s", e.Expr, e.Pos, e.Msg)
+}
+
+func isOperatorRune(r rune) bool {
+	return r == '+' || r == '|' || r == '~'
+}
+
+func isOperatorWord(s string) bool {
+	return s == "AND" || s == "OR" || s == "NOT"
+}
+
+// tokenize 将表达式拆分为 token
+func tokenize(expr string) ([]token, error) {
+	runes := []rune(expr)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: pos})
+			i++
+		case r == '+':
+			tokens = append(tokens, token{kind: tokAnd, text: "+", pos: pos})
+			i++
+		case r == '|':
+			tokens = append(tokens, token{kind: tokOr, text: "|", pos: pos})
+			i++
+		case r == '~':
+			tokens = append(tokens, token{kind: tokNot, text: "~", pos: pos})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, &ExprError{Expr: expr, Pos: pos, Msg: "的引号没有闭合"}
+			}
+			phrase := string(runes[i+1 : end])
+			if strings.TrimSpace(phrase) == "" {
+				return nil, &ExprError{Expr: expr, Pos: pos, Msg: "的引号内容为空"}
+			}
+			tokens = append(tokens, token{kind: tokPhrase, text: phrase, pos: pos})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !isOperatorRune(runes[end]) &&
+				runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[i:end])
+			if field, rest, ok := splitFieldPrefix(word); ok {
+				name, _, _ := strings.Cut(word, ":")
+				tokens = append(tokens, token{kind: tokField, text: field.String(), pos: pos})
+				if rest == "" {
+					if end >= len(runes) || (runes[end] != '(' && runes[end] != '"') {
+						return nil, &ExprError{Expr: expr, Pos: pos, Msg: fmt.Sprintf("的字段 %s 后缺少关键字", name)}
+					}
+				} else {
+					restPos := pos + len([]rune(name)) + 1
+					tokens = append(tokens, token{kind: tokWord, text: rest, pos: restPos})
+				}
+				i = end
+				continue
+			}
+			kind := tokWord
+			switch word {
+			case "AND":
+				kind = tokAnd
+			case "OR":
+				kind = tokOr
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: pos})
+			i = end
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+// exprNode 表达式语法树节点
+type exprNode interface {
+	eval(doc *matchDoc) bool
+	// spans 收集已命中的表达式在标题中匹配的位置, NOT 中的关键字不计入
+	spans(doc *matchDoc, spans []matchSpan) []matchSpan
+	String() string
+}
+
+type termNode struct {
+	term  string
+	field matchField
+}
+
+func (n *termNode) eval(doc *matchDoc) bool {
+	return strings.Contains(doc.field(n.field), n.term)
+}
+
+func (n *termNode) spans(doc *matchDoc, spans []matchSpan) []matchSpan {
+	if n.field != fieldDefault && n.field != fieldTitle {
+		return spans
+	}
+	return appendTermSpans(spans, doc.title, n.term)
+}
+
+func (n *termNode) String() string {
+	term := n.term
+	if strings.ContainsFunc(term, unicode.IsSpace) {
+		term = `"` + term + `"`
+	}
+	if n.field != fieldDefault {
+		return n.field.String() + ":" + term
+	}
+	return term
+}
+
+type notNode struct {
+	expr exprNode
+}
+
+func (n *notNode) eval(doc *matchDoc) bool {
+	return !n.expr.eval(doc)
+}
+
+func (n *notNode) spans(_ *matchDoc, spans []matchSpan) []matchSpan {
+	return spans
+}
+
+func (n *notNode) String() string {
+	return "NOT " + n.expr.String()
+}
+
+type andNode struct {
+	children []exprNode
+}
+
+func (n *andNode) eval(doc *matchDoc) bool {
+	for _, c := range n.children {
+		if !c.eval(doc) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *andNode) spans(doc *matchDoc, spans []matchSpan) []matchSpan {
+	for _, c := range n.children {
+		spans = c.spans(doc, spans)
+	}
+	return spans
+}
+
+func (n *andNode) String() string {
+	parts := make([]string, 0, len(n.children))
+	for _, c := range n.children {
+		parts = append(parts, c.String())
+	}
+	return "(" + strings.Join(parts, " AND ") + ")"
+}
+
+type orNode struct {
+	children []exprNode
+}
+
+func (n *orNode) eval(doc *matchDoc) bool {
+	for _, c := range n.children {
+		if c.eval(doc) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *orNode) spans(doc *matchDoc, spans []matchSpan) []matchSpan {
+	for _, c := range n.children {
+		if c.eval(doc) {
+			spans = c.spans(doc, spans)
+		}
+	}
+	return spans
+}
+
+func (n *orNode) String() string {
+	parts := make([]string, 0, len(n.children))
+	for _, c := range n.children {
+		parts = append(parts, c.String())
+	}
+	return "(" + strings.Join(parts, " OR ") + ")"
+}
+
+type exprParser struct {
+	expr   string
+	tokens []token
+	pos    int
+}
+
+// parseExpression 解析关键字表达式为语法树
+func parseExpression(expr string) (exprNode, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{expr: expr, tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(p.peek(), "缺少关键字")
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, p.errorf(t, "多余的右括号")
+		}
+		return nil, p.errorf(t, "无法识别 %s", t)
+	}
+	return node, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) errorf(t token, format string, args ...any) error {
+	return &ExprError{Expr: p.expr, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []exprNode{first}
+	for p.peek().kind == tokOr {
+		op := p.next()
+		if !startsOperand(p.peek().kind) {
+			return nil, p.errorf(op, "的运算符 %s 缺少右侧关键字", op.text)
+		}
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &orNode{children: children}, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []exprNode{first}
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokAnd:
+			op := p.next()
+			if !startsOperand(p.peek().kind) {
+				return nil, p.errorf(op, "的运算符 %s 缺少右侧关键字", op.text)
+			}
+		case startsOperand(t.kind):
+			// NOT 或相邻关键字, 视为与
+		default:
+			if len(children) == 1 {
+				return first, nil
+			}
+			return &andNode{children: children}, nil
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	t := p.peek()
+	if t.kind == tokNot {
+		p.next()
+		if !startsOperand(p.peek().kind) {
+			return nil, p.errorf(t, "的运算符 %s 缺少右侧关键字", t.text)
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{expr: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokField:
+		node, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		applyField(node, fieldNames[t.text])
+		return node, nil
+	case tokWord, tokPhrase:
+		return &termNode{term: strings.ToLower(t.text)}, nil
+	case tokLParen:
+		if p.peek().kind == tokRParen {
+			return nil, p.errorf(t, "的括号内为空")
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.errorf(t, "的左括号缺少对应的右括号")
+		}
+		p.next()
+		return node, nil
+	case tokAnd, tokOr:
+		return nil, p.errorf(t, "的运算符 %s 缺少左侧关键字", t.text)
+	case tokRParen:
+		return nil, p.errorf(t, "多余的右括号")
+	default:
+		return nil, p.errorf(t, "缺少关键字")
+	}
+}
+
+func startsOperand(kind tokenKind) bool {
+	return kind == tokWord || kind == tokPhrase || kind == tokLParen || kind == tokNot || kind == tokField
+}
+
+// applyField 为未指定字段的关键字设置匹配字段
+func applyField(node exprNode, field matchField) {
+	switch n := node.(type) {
+	case *termNode:
+		if n.field == fieldDefault {
+			n.field = field
+		}
+	case *notNode:
+		applyField(n.expr, field)
+	case *andNode:
+		for _, c := range n.children {
+			applyField(c, field)
+		}
+	case *orNode:
+		for _, c := range n.children {
+			applyField(c, field)
+		}
+	}
+}
+
+// splitRules 将 /add 的参数拆分为多条关键字规则
+// 空白分隔多条规则, 但引号和括号内的空白以及运算符两侧的空白不分隔
+func splitRules(text string) []string {
+	var chunks []string
+	var buf []rune
+	depth, inQuote, escaped := 0, false, false
+	flush := func() {
+		if len(buf) > 0 {
+			chunks = append(chunks, string(buf))
+			buf = buf[:0]
+		}
+	}
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '(':
+			depth++
+		case r == ')':
+			if depth > 0 {
+				depth--
+			}
+		case unicode.IsSpace(r) && depth == 0:
+			flush()
+			continue
+		}
+		buf = append(buf, r)
+	}
+	flush()
+
+	var rules []string
+	for i, c := range chunks {
+		if i > 0 && (joinsPrev(c) || joinsNext(chunks[i-1])) {
+			rules[len(rules)-1] += " " + c
+			continue
+		}
+		rules = append(rules, c)
+	}
+	return rules
+}
+
+func joinsPrev(chunk string) bool {
+	if isOperatorWord(chunk) {
+		return true
+	}
+	r := []rune(chunk)
+	return isOperatorRune(r[0])
+}
+
+func joinsNext(chunk string) bool {
+	if isOperatorWord(chunk) {
+		return true
+	}
+	r := []rune(chunk)
+	return isOperatorRune(r[len(r)-1])
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseExpression(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string
+	}{
+		{name: "单个关键字", expr: "港仔", want: "港仔"},
+		{name: "旧语法组合", expr: "iPhone+频道~收", want: "(iphone AND 频道 AND NOT 收)"},
+		{name: "与优先于或", expr: "a OR b AND c", want: "(a OR (b AND c))"},
+		{name: "括号改变优先级", expr: "(a OR b) AND c", want: "((a OR b) AND c)"},
+		{name: "NOT 作为中缀", expr: "港仔 NOT 收", want: "(港仔 AND NOT 收)"},
+		{name: "嵌套括号", expr: "((a|b)+(c|d))~e", want: "(((a OR b) AND (c OR d)) AND NOT e)"},
+		{name: "引号短语", expr: `"iPhone 15" OR pixel`, want: `("iphone 15" OR pixel)`},
+		{name: "括号内相邻关键字为与", expr: "(a b) OR c", want: "((a AND b) OR c)"},
+		{name: "字段前缀", expr: "desc:年付", want: "desc:年付"},
+		{name: "字段前缀作用于括号", expr: "desc:(a OR title:b) AND cat:交易", want: "((desc:a OR title:b) AND cat:交易)"},
+		{name: "字段前缀与短语", expr: `author:"foo bar"`, want: `author:"foo bar"`},
+		{name: "非字母前缀不是字段", expr: "10:30", want: "10:30"},
+		{name: "字段前缀不区分大小写", expr: "DESC:年付", want: "desc:年付"},
+		{name: "未知前缀按普通关键字", expr: "Re:Zero", want: "re:zero"},
+		{name: "链接按普通关键字", expr: "http://x.com", want: "http://x.com"},
+		{name: "拼错的字段按普通关键字", expr: "a OR tilte:b", want: "(a OR tilte:b)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parseExpression(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, node.String())
+		})
+	}
+}
+
+func Test_parseExpressionError(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		pos  int
+	}{
+		{name: "缺少右括号", expr: "a AND (b OR c", pos: 7},
+		{name: "多余的右括号", expr: "a OR b)", pos: 7},
+		{name: "缺少右侧关键字", expr: "a OR", pos: 3},
+		{name: "缺少左侧关键字", expr: "AND b", pos: 1},
+		{name: "连续运算符", expr: "a + | b", pos: 3},
+		{name: "空括号", expr: "a ()", pos: 3},
+		{name: "引号未闭合", expr: `a "b c`, pos: 3},
+		{name: "中文位置按字符计算", expr: "港仔+", pos: 3},
+		{name: "字段后缺少关键字", expr: "desc: a", pos: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseExpression(tt.expr)
+			var exprErr *ExprError
+			if assert.True(t, errors.As(err, &exprErr), "err = %v", err) {
+				assert.Equal(t, tt.pos, exprErr.Pos, exprErr.Error())
+			}
+		})
+	}
+}
+
+func Test_splitRules(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "多个关键字", text: "linux windows", want: []string{"linux", "windows"}},
+		{name: "运算符连接", text: "iPhone AND 频道 NOT 收 斯巴达", want: []string{"iPhone AND 频道 NOT 收", "斯巴达"}},
+		{name: "符号运算符两侧空格", text: "港仔 + 出 boil", want: []string{"港仔 + 出", "boil"}},
+		{name: "括号内空格", text: "(a OR b) AND c d", want: []string{"(a OR b) AND c", "d"}},
+		{name: "引号内空格", text: `"iPhone 15" pixel`, want: []string{`"iPhone 15"`, "pixel"}},
+		{name: "正则表达式", text: `(?=.*(港仔|boil))(?=.*出) bgp`, want: []string{`(?=.*(港仔|boil))(?=.*出)`, "bgp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, splitRules(tt.text))
+		})
+	}
+}
+
+func Test_fieldPrefixLiteral(t *testing.T) {
+	// 不是字段名的前缀保留冒号, /add 时不会报错
+	assert.NoError(t, validateKeywords([]string{"Re:Zero", "http://x.com"}))
+	_, ok := hasKeyword("[字幕] Re:Zero 第三季", []string{"Re:Zero"})
+	assert.True(t, ok)
+	_, ok = hasKeyword("镜像 http://x.com 可用", []string{"http://x.com"})
+	assert.True(t, ok)
+}
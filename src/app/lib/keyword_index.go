@@ -0,0 +1,138 @@
+package lib
+
+// keywordIndex 单个 feed 所有订阅的关键字倒排索引
+// 所有规则的标题关键字放入同一个 Aho-Corasick 自动机, 一次扫描即可得到候选订阅者:
+// 只匹配标题的纯关键字命中即匹配; 表达式规则需至少命中其一个必要关键字才会被验证;
+// 正则、纯排除及只匹配其他字段的规则放入兜底列表逐个匹配
+type keywordIndex struct {
+	ac       *ahoCorasick
+	patterns []indexPattern // 模式编号 -> 命中后的处理
+	fallback []indexedRule
+}
+
+type indexedRule struct {
+	chatId int64
+	rule   *keywordRule
+}
+
+type indexPattern struct {
+	owners     []int64       // 命中即匹配的订阅者
+	candidates []indexedRule // 命中后需要验证的规则
+}
+
+// plainTerm 判断规则是否为只匹配标题的纯关键字
+func plainTerm(rule *keywordRule) (string, bool) {
+	term, ok := rule.expr.(*termNode)
+	if !ok || (term.field != fieldDefault && term.field != fieldTitle) {
+		return "", false
+	}
+	return term.term, true
+}
+
+// triggerTerms 返回表达式成立时标题中至少会出现其一的关键字
+// 无法确定时(例如纯排除、匹配其他字段)返回 false
+func triggerTerms(node exprNode) ([]string, bool) {
+	switch n := node.(type) {
+	case *termNode:
+		if n.field != fieldDefault && n.field != fieldTitle {
+			return nil, false
+		}
+		return []string{n.term}, true
+	case *andNode:
+		// 任选一个子表达式即可, 取关键字最少的
+		var best []string
+		found := false
+		for _, c := range n.children {
+			terms, ok := triggerTerms(c)
+			if ok && (!found || len(terms) < len(best)) {
+				best, found = terms, true
+			}
+		}
+		return best, found
+	case *orNode:
+		var all []string
+		for _, c := range n.children {
+			terms, ok := triggerTerms(c)
+			if !ok {
+				return nil, false
+			}
+			all = append(all, terms...)
+		}
+		return all, true
+	default:
+		return nil, false
+	}
+}
+
+func newKeywordIndex(matchers []*subscriptionMatcher) *keywordIndex {
+	idx := &keywordIndex{}
+	patternIds := make(map[string]int)
+	var patterns []string
+	patternId := func(term string) int {
+		id, exists := patternIds[term]
+		if !exists {
+			id = len(patterns)
+			patternIds[term] = id
+			patterns = append(patterns, term)
+			idx.patterns = append(idx.patterns, indexPattern{})
+		}
+		return id
+	}
+
+	for _, m := range matchers {
+		for _, rule := range m.rules {
+			if term, ok := plainTerm(rule); ok {
+				id := patternId(term)
+				idx.patterns[id].owners = append(idx.patterns[id].owners, m.ChatId)
+				continue
+			}
+			var terms []string
+			ok := false
+			if rule.expr != nil {
+				terms, ok = triggerTerms(rule.expr)
+			}
+			if !ok {
+				idx.fallback = append(idx.fallback, indexedRule{chatId: m.ChatId, rule: rule})
+				continue
+			}
+			for _, term := range terms {
+				id := patternId(term)
+				idx.patterns[id].candidates = append(idx.patterns[id].candidates, indexedRule{chatId: m.ChatId, rule: rule})
+			}
+		}
+	}
+	idx.ac = newAhoCorasick(patterns)
+	return idx
+}
+
+// match 返回条目命中的订阅者
+func (idx *keywordIndex) match(doc *matchDoc) map[int64]struct{} {
+	hits := make(map[int64]struct{})
+	seen := make(map[int]struct{})
+	var candidates []indexedRule
+	idx.ac.find(doc.title, func(pattern int) {
+		if _, ok := seen[pattern]; ok {
+			return
+		}
+		seen[pattern] = struct{}{}
+		p := &idx.patterns[pattern]
+		for _, chatId := range p.owners {
+			hits[chatId] = struct{}{}
+		}
+		candidates = append(candidates, p.candidates...)
+	})
+
+	verify := func(rules []indexedRule) {
+		for _, r := range rules {
+			if _, ok := hits[r.chatId]; ok {
+				continue
+			}
+			if r.rule.match(doc) {
+				hits[r.chatId] = struct{}{}
+			}
+		}
+	}
+	verify(candidates)
+	verify(idx.fallback)
+	return hits
+}
@@ -0,0 +1,219 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/dlclark/regexp2"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// regexOnlyChars 只在正则中有意义的字符, 出现这些字符时按正则处理
+const regexOnlyChars = "^$*?[]{}\\"
+
+// keywordRule 编译后的单条关键字规则
+type keywordRule struct {
+	raw   string
+	expr  exprNode        // 表达式规则
+	re    *regexp2.Regexp // 正则规则
+	field matchField      // 正则规则匹配的字段
+	// legacy 升级前保存、新语法无法解析或含义不同的关键字, 按升级前的方式匹配标题
+	legacy     bool
+	legacyExpr exprNode // 升级前的 + | ~ 表达式
+
+	// 规则所属的订阅或 webhook, 只有这两类规则会在多次超时后停用
+	// /test, --backfill 等临时匹配使用的规则没有所属者, 共享缓存中的同一条规则不会因此停用
+	chatId    int64
+	feedId    string
+	webhookId uint
+	timeouts  atomic.Int32
+	disabled  atomic.Bool
+}
+
+func looksLikeRegex(keyword string) bool {
+	return strings.ContainsAny(keyword, regexOnlyChars)
+}
+
+// compileKeyword 编译关键字, 普通关键字与 AND/OR/NOT 表达式解析为语法树, 其余按正则编译
+// 正则可以使用字段前缀指定匹配的字段, 例如 desc:(?=.*年付)
+func compileKeyword(keyword string) (*keywordRule, error) {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return nil, errors.New("关键字不能为空")
+	}
+	if looksLikeRegex(keyword) {
+		field, pattern, _ := splitFieldPrefix(keyword)
+		re, ok := getCachedRegex(pattern)
+		if !ok {
+			return nil, fmt.Errorf("关键字 %s 不是合法的正则表达式", keyword)
+		}
+		return &keywordRule{raw: keyword, re: re, field: field}, nil
+	}
+	node, err := parseExpression(keyword)
+	if err != nil {
+		return nil, err
+	}
+	return &keywordRule{raw: keyword, expr: node}, nil
+}
+
+// keywordMatch 条目命中的规则及标题中匹配的位置
+type keywordMatch struct {
+	Rule  string
+	Spans []matchSpan // 按位置排序且互不重叠, 只匹配正文等其它字段时为空
+}
+
+// matchSpan 标题中匹配的一段, 按字符计数, 不包含 End
+type matchSpan struct {
+	Start int
+	End   int
+}
+
+// maxMatchSpans 单条规则最多记录的匹配位置数
+const maxMatchSpans = 20
+
+// find 判断条目是否匹配, 命中时返回标题中匹配的位置
+func (r *keywordRule) find(doc *matchDoc) (keywordMatch, bool) {
+	if !r.match(doc) {
+		return keywordMatch{}, false
+	}
+	var spans []matchSpan
+	if r.expr != nil {
+		spans = r.expr.spans(doc, nil)
+	} else if r.legacyExpr != nil && r.legacyExpr.eval(doc) {
+		spans = r.legacyExpr.spans(doc, nil)
+	} else if r.re != nil && (r.field == fieldDefault || r.field == fieldTitle) {
+		spans = r.regexSpans(doc.title)
+	}
+	return keywordMatch{Rule: r.raw, Spans: mergeSpans(spans)}, true
+}
+
+// regexSpans 正则在标题中匹配的位置, regexp2 按字符返回位置
+func (r *keywordRule) regexSpans(title string) []matchSpan {
+	var spans []matchSpan
+	m, err := r.re.FindStringMatch(title)
+	for m != nil && err == nil && len(spans) < maxMatchSpans {
+		if m.Length > 0 {
+			spans = append(spans, matchSpan{Start: m.Index, End: m.Index + m.Length})
+		}
+		m, err = r.re.FindNextMatch(m)
+	}
+	if err != nil {
+		logx.Errorw("keyword regex find spans failed", logx.Field("err", err), logx.Field("keyword", r.raw))
+	}
+	return spans
+}
+
+// appendTermSpans 追加 term 在 text 中出现的位置
+func appendTermSpans(spans []matchSpan, text, term string) []matchSpan {
+	if term == "" {
+		return spans
+	}
+	offset, runes := 0, 0
+	for n := 0; n < maxMatchSpans; n++ {
+		i := strings.Index(text[offset:], term)
+		if i < 0 {
+			break
+		}
+		runes += utf8.RuneCountInString(text[offset : offset+i])
+		length := utf8.RuneCountInString(term)
+		spans = append(spans, matchSpan{Start: runes, End: runes + length})
+		runes += length
+		offset += i + len(term)
+	}
+	return spans
+}
+
+// mergeSpans 排序并合并重叠或相邻的位置
+func mergeSpans(spans []matchSpan) []matchSpan {
+	if len(spans) == 0 {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s.Start <= last.End {
+			last.End = max(last.End, s.End)
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// match 判断条目是否匹配
+func (r *keywordRule) match(doc *matchDoc) bool {
+	if r.expr != nil {
+		return r.expr.eval(doc)
+	}
+	if r.legacy {
+		return r.matchLegacy(doc)
+	}
+	if r.disabled.Load() {
+		return false
+	}
+	ok, err := r.re.MatchString(doc.field(r.field))
+	if err != nil {
+		r.onTimeout(err)
+		return false
+	}
+	return ok
+}
+
+// onTimeout 记录正则匹配超时, 订阅或 webhook 的规则超时次数过多时停用
+func (r *keywordRule) onTimeout(err error) {
+	logx.Errorw("keyword regex match timeout", logx.Field("err", err), logx.Field("keyword", r.raw),
+		logx.Field("chatId", r.chatId), logx.Field("feedId", r.feedId), logx.Field("webhookId", r.webhookId))
+	if r.chatId == 0 && r.webhookId == 0 {
+		return
+	}
+	if r.timeouts.Add(1) < maxRegexTimeouts || !r.disabled.CompareAndSwap(false, true) {
+		return
+	}
+	if r.chatId != 0 {
+		go onRuleDisabled(r.chatId, r.feedId, r.raw)
+	} else {
+		go onWebhookRuleDisabled(r.webhookId, r.raw)
+	}
+}
+
+// 缓存已编译的关键字规则
+var ruleCache = sync.Map{}
+
+func getCachedRule(keyword string) (*keywordRule, error) {
+	if v, ok := ruleCache.Load(keyword); ok {
+		return v.(*keywordRule), nil
+	}
+	rule, err := compileStoredKeyword(keyword, false)
+	if err != nil {
+		return nil, err
+	}
+	ruleCache.Store(keyword, rule)
+	return rule, nil
+}
+
+// validateKeywords 校验关键字语法, 返回所有错误
+func validateKeywords(keywords []string) error {
+	var errs []string
+	for _, keyword := range keywords {
+		rule, err := compileKeyword(keyword)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if rule.re != nil {
+			if err := checkRegexComplexity(keyword, rule.re.String()); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
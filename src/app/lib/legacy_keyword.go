@@ -0,0 +1,215 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thoas/go-funk"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/rescue"
+
+	"ns-rss/src/app/db"
+)
+
+// legacySpecialChars 升级前含有这些字符的关键字按 + | ~ 表达式或正则匹配
+const legacySpecialChars = "^$.*+?()[]{}|\\~"
+
+// legacyRegexChars 升级前只在正则中起作用的字符, 出现时原来的含义无法用新语法的表达式表示
+const legacyRegexChars = "^$.*?()[]{}\\"
+
+// compileStoredKeyword 编译已保存的关键字
+// legacy 为 true 或新语法无法解析时按升级前的方式匹配标题, 避免升级后已保存的关键字静默改变含义
+func compileStoredKeyword(keyword string, legacy bool) (*keywordRule, error) {
+	rule, err := compileKeyword(keyword)
+	if (err == nil && !legacy) || strings.TrimSpace(keyword) == "" {
+		return rule, err
+	}
+	return &keywordRule{raw: keyword, legacy: true, legacyExpr: legacyExpression(strings.ToLower(keyword))}, nil
+}
+
+// legacyExpression 升级前的表达式: | 分隔的任一部分满足即可, 每部分内 + 分隔的关键字都需包含, ~ 开头的需不包含
+// 不含特殊字符时整个关键字按子串匹配, 空的关键字被忽略, 全部为空时返回 nil
+func legacyExpression(keyword string) exprNode {
+	if !strings.ContainsAny(keyword, legacySpecialChars) {
+		return &termNode{term: keyword}
+	}
+	var ors []exprNode
+	for _, orPart := range strings.Split(keyword, "|") {
+		var ands []exprNode
+		for _, part := range strings.Split(orPart, "+") {
+			part = strings.TrimSpace(part)
+			if exclude, ok := strings.CutPrefix(part, "~"); ok {
+				if exclude != "" {
+					ands = append(ands, &notNode{expr: &termNode{term: exclude}})
+				}
+			} else if part != "" {
+				ands = append(ands, &termNode{term: part})
+			}
+		}
+		switch len(ands) {
+		case 0:
+		case 1:
+			ors = append(ors, ands[0])
+		default:
+			ors = append(ors, &andNode{children: ands})
+		}
+	}
+	switch len(ors) {
+	case 0:
+		return nil
+	case 1:
+		return ors[0]
+	default:
+		return &orNode{children: ors}
+	}
+}
+
+// matchLegacy 升级前的匹配方式: 不含特殊字符时按子串匹配, 否则先按 + | ~ 表达式匹配, 含有正则字符时再按正则匹配
+func (r *keywordRule) matchLegacy(doc *matchDoc) bool {
+	if r.legacyExpr != nil && r.legacyExpr.eval(doc) {
+		return true
+	}
+	// 只含 + | ~ 时正则能命中的标题表达式都已命中, 不再按正则匹配, 避免 a||b 中的空分支命中所有标题
+	if !strings.ContainsAny(r.raw, legacyRegexChars) || r.disabled.Load() {
+		return false
+	}
+	re, ok := getCachedRegex(r.raw)
+	if !ok {
+		return false
+	}
+	ok, err := re.MatchString(doc.title)
+	if err != nil {
+		r.onTimeout(err)
+		return false
+	}
+	return ok
+}
+
+// legacyKeywordReason 比较关键字按升级前后两种语法的含义, 不一致时返回原因
+func legacyKeywordReason(keyword string) (string, bool) {
+	if strings.TrimSpace(keyword) == "" {
+		return "", false
+	}
+	rule, err := compileKeyword(keyword)
+	if err != nil {
+		return err.Error(), true
+	}
+	if rule.re != nil {
+		// 正则的含义不变, 只有字段前缀原来属于正则的一部分
+		if rule.field != fieldDefault {
+			return fmt.Sprintf("原来按整个正则匹配标题, 新语法只匹配 %s 字段", rule.field), true
+		}
+		return "", false
+	}
+	lower := strings.ToLower(keyword)
+	if strings.ContainsAny(lower, legacyRegexChars) {
+		return fmt.Sprintf("原来按正则匹配, 新语法解析为 %s", rule.expr), true
+	}
+	legacy := legacyExpression(lower)
+	if legacy == nil {
+		return "原来不匹配任何标题", true
+	}
+	if !sameExpr(legacy, rule.expr) {
+		return fmt.Sprintf("原来按 %s 匹配, 新语法解析为 %s", legacy, rule.expr), true
+	}
+	return "", false
+}
+
+// sameExpr 判断两个语法树是否相同
+func sameExpr(a, b exprNode) bool {
+	switch x := a.(type) {
+	case *termNode:
+		y, ok := b.(*termNode)
+		return ok && x.term == y.term && x.field == y.field
+	case *notNode:
+		y, ok := b.(*notNode)
+		return ok && sameExpr(x.expr, y.expr)
+	case *andNode:
+		y, ok := b.(*andNode)
+		return ok && sameChildren(x.children, y.children)
+	case *orNode:
+		y, ok := b.(*orNode)
+		return ok && sameChildren(x.children, y.children)
+	default:
+		return false
+	}
+}
+
+func sameChildren(a, b []exprNode) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameExpr(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkStoredKeywords 找出升级前保存、新旧语法含义不同的关键字, 这些关键字之后仍按升级前的方式匹配
+func checkStoredKeywords(cnf db.SubscribeConfig) []string {
+	var legacy []string
+	for _, keyword := range cnf.KeywordsArray {
+		if _, ok := legacyKeywordReason(keyword); ok {
+			legacy = append(legacy, keyword)
+		}
+	}
+	return legacy
+}
+
+// MigrateStoredKeywords 检查尚未检查过的订阅, 记录按升级前的方式匹配的关键字, 并在后台通知订阅者
+func MigrateStoredKeywords() {
+	changed := false
+	for _, cnf := range db.ListAllSubscribeConfig() {
+		if cnf.KeywordsChecked {
+			continue
+		}
+		legacy := checkStoredKeywords(cnf)
+		ok, err := db.CheckSubscribeKeywords(cnf.ID, legacy)
+		if err != nil {
+			logx.Errorw("check stored keywords failed", logx.Field("err", err),
+				logx.Field("chatId", cnf.ChatId), logx.Field("feedId", cnf.FeedId))
+			continue
+		}
+		changed = changed || (ok && len(legacy) > 0)
+	}
+	if changed {
+		MatcherRegistryInstance().InvalidateAll()
+	}
+	go reportLegacyKeywords()
+}
+
+// reportLegacyKeywords 通知订阅者哪些关键字仍按升级前的方式匹配, 每个订阅只通知一次
+func reportLegacyKeywords() {
+	defer rescue.Recover()
+
+	for _, cnf := range db.ListAllSubscribeConfig() {
+		if !cnf.KeywordsChecked || cnf.LegacyNotified {
+			continue
+		}
+		var keywords, reasons []string
+		for _, keyword := range cnf.LegacyKeywordsArray {
+			if !funk.ContainsString(cnf.KeywordsArray, keyword) {
+				continue
+			}
+			reason, ok := legacyKeywordReason(keyword)
+			if !ok {
+				continue
+			}
+			keywords = append(keywords, keyword)
+			reasons = append(reasons, reason)
+		}
+		if len(keywords) > 0 {
+			logx.Infow("stored keywords keep legacy matching", logx.Field("chatId", cnf.ChatId),
+				logx.Field("feedId", cnf.FeedId), logx.Field("keywords", keywords))
+			if !notifyLegacyKeywords(cnf.ChatId, cnf.FeedId, keywords, reasons) {
+				continue
+			}
+		}
+		if err := db.MarkSubscribeLegacyNotified(cnf.ID); err != nil {
+			logx.Errorw("mark legacy keywords notified failed", logx.Field("err", err),
+				logx.Field("chatId", cnf.ChatId), logx.Field("feedId", cnf.FeedId))
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// matchField 关键字匹配的目标字段
+type matchField int
+
+const (
+	fieldDefault matchField = iota // 未指定字段, 匹配标题
+	fieldTitle
+	fieldDesc
+	fieldAuthor
+	fieldCategory
+)
+
+// fieldNames 关键字中可使用的字段前缀, 例如 desc:年付
+var fieldNames = map[string]matchField{
+	"title":  fieldTitle,
+	"desc":   fieldDesc,
+	"author": fieldAuthor,
+	"cat":    fieldCategory,
+}
+
+func (f matchField) String() string {
+	switch f {
+	case fieldTitle:
+		return "title"
+	case fieldDesc:
+		return "desc"
+	case fieldAuthor:
+		return "author"
+	case fieldCategory:
+		return "cat"
+	default:
+		return ""
+	}
+}
+
+// splitFieldPrefix 拆分 field:rest 形式的字段前缀, 前缀不区分大小写
+// 只有 title desc author cat 视为字段, 其余例如 Re:Zero、http://x.com 按普通文本处理, 返回 ok=false
+func splitFieldPrefix(s string) (field matchField, rest string, ok bool) {
+	name, rest, found := strings.Cut(s, ":")
+	if !found {
+		return fieldDefault, s, false
+	}
+	field, ok = fieldNames[strings.ToLower(name)]
+	if !ok {
+		return fieldDefault, s, false
+	}
+	return field, rest, true
+}
+
+// matchDoc 参与匹配的条目内容, 均已转为小写
+type matchDoc struct {
+	title    string
+	desc     string
+	author   string
+	category string
+}
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// stripHTML 去除 html 标签并合并连续空白
+func stripHTML(s string) string {
+	s = html.UnescapeString(htmlTagRe.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// newTitleDoc 仅包含标题的匹配内容
+func newTitleDoc(title string) *matchDoc {
+	return &matchDoc{title: strings.ToLower(title)}
+}
+
+// newMatchDoc 从 RSS 条目构建匹配内容
+func newMatchDoc(item *gofeed.Item) *matchDoc {
+	doc := &matchDoc{
+		title: strings.ToLower(item.Title),
+		desc:  strings.ToLower(stripHTML(item.Description + "\n" + item.Content)),
+	}
+
+	var authors []string
+	if item.Author != nil {
+		authors = append(authors, item.Author.Name, item.Author.Email)
+	}
+	for _, a := range item.Authors {
+		if a != nil {
+			authors = append(authors, a.Name, a.Email)
+		}
+	}
+	doc.author = strings.ToLower(strings.Join(authors, "\n"))
+	doc.category = strings.ToLower(strings.Join(item.Categories, "\n"))
+	return doc
+}
+
+func (d *matchDoc) field(f matchField) string {
+	switch f {
+	case fieldDesc:
+		return d.desc
+	case fieldAuthor:
+		return d.author
+	case fieldCategory:
+		return d.category
+	default:
+		return d.title
+	}
+}
@@ -0,0 +1,203 @@
+package lib
+
+import (
+	"sync"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"ns-rss/src/app/db"
+)
+
+var matcherRegistry *MatcherRegistry
+
+func init() {
+	matcherRegistry = NewMatcherRegistry()
+}
+
+func MatcherRegistryInstance() *MatcherRegistry {
+	return matcherRegistry
+}
+
+// subscriptionMatcher 单个订阅(chatId + feedId)已编译的关键字规则
+type subscriptionMatcher struct {
+	ChatId int64
+	FeedId string
+	rules  []*keywordRule
+}
+
+func newSubscriptionMatcher(cnf db.SubscribeConfig) *subscriptionMatcher {
+	m := &subscriptionMatcher{
+		ChatId: cnf.ChatId,
+		FeedId: cnf.FeedId,
+		rules:  make([]*keywordRule, 0, len(cnf.KeywordsArray)),
+	}
+	for _, keyword := range cnf.KeywordsArray {
+		if cnf.IsKeywordDisabled(keyword) {
+			continue
+		}
+		rule, err := compileStoredKeyword(keyword, cnf.IsLegacyKeyword(keyword))
+		if err != nil {
+			logx.Errorw("compile keyword failed", logx.Field("err", err), logx.Field("chatId", cnf.ChatId), logx.Field("feedId", cnf.FeedId))
+			continue
+		}
+		rule.chatId = cnf.ChatId
+		rule.feedId = cnf.FeedId
+		m.rules = append(m.rules, rule)
+	}
+	return m
+}
+
+// onRuleDisabled 正则规则多次匹配超时后的处理, 测试中可替换
+var onRuleDisabled = disableTimedOutRule
+
+// disableTimedOutRule 持久化停用状态, 重新编译订阅并通知规则所有者
+func disableTimedOutRule(chatId int64, feedId string, keyword string) {
+	if err := db.DisableSubscribeKeyword(chatId, feedId, keyword); err != nil {
+		logx.Errorw("disable keyword failed", logx.Field("err", err), logx.Field("chatId", chatId), logx.Field("feedId", feedId))
+	}
+	MatcherRegistryInstance().Reload(chatId, feedId)
+	notifyRuleDisabled(chatId, feedId, keyword)
+}
+
+// match 判断条目是否匹配任意一条规则
+func (m *subscriptionMatcher) match(doc *matchDoc) bool {
+	_, ok := m.matchRule(doc)
+	return ok
+}
+
+// matchRule 返回条目命中的第一条规则及标题中匹配的位置
+func (m *subscriptionMatcher) matchRule(doc *matchDoc) (keywordMatch, bool) {
+	for _, rule := range m.rules {
+		if match, ok := rule.find(doc); ok {
+			return match, true
+		}
+	}
+	return keywordMatch{}, false
+}
+
+// feedMatchers 单个 feed 的所有订阅匹配器及其倒排索引
+type feedMatchers struct {
+	matchers map[int64]*subscriptionMatcher
+	index    *keywordIndex // 订阅变更后置空, 下次使用时重建
+}
+
+// MatcherRegistry 按 feed 缓存所有订阅已编译的关键字, 供抓取协程共享
+// 订阅配置变更时需调用 Reload/Invalidate 使缓存失效
+type MatcherRegistry struct {
+	mu    sync.RWMutex
+	feeds map[string]*feedMatchers
+}
+
+func NewMatcherRegistry() *MatcherRegistry {
+	return &MatcherRegistry{
+		feeds: make(map[string]*feedMatchers),
+	}
+}
+
+// load 返回 feed 的缓存, 首次访问时从数据库加载, 调用方需持有写锁
+func (r *MatcherRegistry) load(feedId string) *feedMatchers {
+	if fm, ok := r.feeds[feedId]; ok {
+		return fm
+	}
+	fm := &feedMatchers{matchers: make(map[int64]*subscriptionMatcher)}
+	for _, cnf := range db.ListSubscribeConfigWithFeedId(feedId) {
+		if len(cnf.KeywordsArray) == 0 {
+			continue
+		}
+		fm.matchers[cnf.ChatId] = newSubscriptionMatcher(cnf)
+	}
+	r.feeds[feedId] = fm
+	return fm
+}
+
+// Feed 返回订阅了该 feed 的所有匹配器
+func (r *MatcherRegistry) Feed(feedId string) []*subscriptionMatcher {
+	r.mu.RLock()
+	fm, ok := r.feeds[feedId]
+	if ok {
+		list := toMatcherList(fm.matchers)
+		r.mu.RUnlock()
+		return list
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return toMatcherList(r.load(feedId).matchers)
+}
+
+// Get 返回订阅者在该 feed 的匹配器
+func (r *MatcherRegistry) Get(feedId string, chatId int64) (*subscriptionMatcher, bool) {
+	r.mu.RLock()
+	fm, ok := r.feeds[feedId]
+	if ok {
+		m, ok := fm.matchers[chatId]
+		r.mu.RUnlock()
+		return m, ok
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, ok := r.load(feedId).matchers[chatId]
+	return m, ok
+}
+
+// Index 返回 feed 的关键字倒排索引
+func (r *MatcherRegistry) Index(feedId string) *keywordIndex {
+	r.mu.RLock()
+	fm, ok := r.feeds[feedId]
+	if ok && fm.index != nil {
+		idx := fm.index
+		r.mu.RUnlock()
+		return idx
+	}
+	r.mu.RUnlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fm = r.load(feedId)
+	if fm.index == nil {
+		fm.index = newKeywordIndex(toMatcherList(fm.matchers))
+	}
+	return fm.index
+}
+
+func toMatcherList(matchers map[int64]*subscriptionMatcher) []*subscriptionMatcher {
+	list := make([]*subscriptionMatcher, 0, len(matchers))
+	for _, m := range matchers {
+		list = append(list, m)
+	}
+	return list
+}
+
+// Reload 重新编译单个订阅的关键字
+func (r *MatcherRegistry) Reload(chatId int64, feedId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fm, ok := r.feeds[feedId]
+	if !ok {
+		// 尚未加载, 下次访问时会从数据库读取
+		return
+	}
+	fm.index = nil
+	cnf := db.ListSubscribeFeedWith(chatId, feedId)
+	if cnf.ID == 0 || len(cnf.KeywordsArray) == 0 {
+		delete(fm.matchers, chatId)
+		return
+	}
+	fm.matchers[chatId] = newSubscriptionMatcher(cnf)
+}
+
+// Invalidate 清除单个 feed 的缓存
+func (r *MatcherRegistry) Invalidate(feedId string) {
+	r.mu.Lock()
+	delete(r.feeds, feedId)
+	r.mu.Unlock()
+}
+
+// InvalidateAll 清除所有缓存
+func (r *MatcherRegistry) InvalidateAll() {
+	r.mu.Lock()
+	r.feeds = make(map[string]*feedMatchers)
+	r.mu.Unlock()
+}
@@ -0,0 +1,200 @@
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"ns-rss/src/app/db"
+	"ns-rss/src/app/msgfmt"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// defaultMessageTemplate 内置的消息模板, 加粗标题中命中的关键字并在末尾显示命中的规则
+const defaultMessageTemplate = "📢  {{.TitleHighlight}}\n\n🕐 {{.Time}}\n\n👉 {{.Link}}{{if .Keyword}}\n\n🎯 命中规则: `{{.Keyword}}`{{end}}"
+
+const (
+	maxTemplateLength       = 1000 // 模板最大长度
+	maxTemplateOutputLength = 3500 // 模板生成的消息最大长度
+	maxTemplateDescLength   = 200  // 模板中正文描述的最大长度
+)
+
+// messageData 模板中可以使用的变量, 字符串已按 msgfmt 标记格式转义
+type messageData struct {
+	Title          string
+	TitleHighlight string // 标题, 命中关键字的部分加粗
+	Link           string
+	Description    string // 正文描述, 去掉 html 标签, 最多200字
+	Author         string
+	Categories     string // 分类, 多个用逗号分隔
+	FeedId         string
+	FeedName       string
+	Keyword        string    // 命中的关键字
+	Time           string    // 发布时间, 订阅者时区, 格式 2006-01-02 15:04:05
+	Published      time.Time // 发布时间, 订阅者时区, 可以使用 {{.Published.Format "01-02 15:04"}}
+}
+
+func newMessageData(item *gofeed.Item, link, feedId, feedName string, match keywordMatch, published time.Time) messageData {
+	var author string
+	if item.Author != nil {
+		author = item.Author.Name
+	}
+	return messageData{
+		Title:          msgfmt.Escape(item.Title),
+		TitleHighlight: highlightTitle(item.Title, match.Spans),
+		Link:           msgfmt.Escape(link),
+		Description:    msgfmt.Escape(truncateRunes(stripHTML(item.Description), maxTemplateDescLength)),
+		Author:         msgfmt.Escape(author),
+		Categories:     msgfmt.Escape(strings.Join(item.Categories, ", ")),
+		FeedId:         msgfmt.Escape(feedId),
+		FeedName:       msgfmt.Escape(feedName),
+		Keyword:        msgfmt.Escape(match.Rule),
+		Time:           published.Format("2006-01-02 15:04:05"),
+		Published:      published,
+	}
+}
+
+// highlightTitle 转义标题并加粗匹配的位置
+// 位置按小写后的标题计算, strings.ToLower 逐个字符转换, 与原标题的字符位置一致
+func highlightTitle(title string, spans []matchSpan) string {
+	runes := []rune(title)
+	if len(spans) == 0 {
+		return msgfmt.Escape(title)
+	}
+	var sb strings.Builder
+	last := 0
+	for _, s := range spans {
+		if s.Start < last || s.End > len(runes) {
+			break
+		}
+		sb.WriteString(msgfmt.Escape(string(runes[last:s.Start])))
+		sb.WriteString("*" + msgfmt.Escape(string(runes[s.Start:s.End])) + "*")
+		last = s.End
+	}
+	sb.WriteString(msgfmt.Escape(string(runes[last:])))
+	return sb.String()
+}
+
+// sampleMessageData 校验和预览模板使用的示例数据
+func sampleMessageData(loc *time.Location) messageData {
+	published := time.Date(2024, 5, 1, 9, 30, 0, 0, loc)
+	title := "[出] 港仔 年付 *特价*"
+	match, _ := hasKeyword(title, []string{"港仔 AND 出"})
+	return newMessageData(&gofeed.Item{
+		Title:       title,
+		Description: "<p>年付 10 刀, 可以 PayPal</p>",
+		Author:      &gofeed.Person{Name: "nodeseek"},
+		Categories:  []string{"交易"},
+	}, "https://www.nodeseek.com/post-1-1", "ns", "NodeSeek", match, published)
+}
+
+var templateFuncs = template.FuncMap{
+	// truncate 按字符截断, 例如 {{truncate 20 .Title}}, 先去掉转义避免截断在转义字符中间
+	"truncate": func(n int, s string) string {
+		if n <= 0 {
+			return ""
+		}
+		return msgfmt.Escape(truncateRunes(msgfmt.Parse(s).Plain(), n))
+	},
+}
+
+var templateCache sync.Map // 模板内容 -> *template.Template
+
+// parseMessageTemplate 解析模板, 解析结果按内容缓存
+func parseMessageTemplate(text string) (*template.Template, error) {
+	if t, ok := templateCache.Load(text); ok {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("message").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	templateCache.Store(text, t)
+	return t, nil
+}
+
+// limitedWriter 限制模板输出的长度, 防止模板生成过长的消息
+type limitedWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+var errTemplateTooLong = fmt.Errorf("模板生成的消息超过 %d 字节", maxTemplateOutputLength)
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.n {
+		return 0, errTemplateTooLong
+	}
+	return w.buf.Write(p)
+}
+
+// renderMessageTemplate 使用模板生成消息
+func renderMessageTemplate(text string, data messageData) (string, error) {
+	t, err := parseMessageTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	w := &limitedWriter{n: maxTemplateOutputLength}
+	if err := t.Execute(w, data); err != nil {
+		if errors.Is(err, errTemplateTooLong) {
+			return "", errTemplateTooLong
+		}
+		return "", err
+	}
+	return w.buf.String(), nil
+}
+
+// ValidateMessageTemplate 校验模板语法, 并使用示例数据检查生成的消息
+// 模板本身的文字按 msgfmt 标记格式解析, 可以使用 *加粗* `代码` [文字](链接)
+func ValidateMessageTemplate(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errors.New("模板不能为空")
+	}
+	if len([]rune(text)) > maxTemplateLength {
+		return fmt.Errorf("模板不能超过 %d 个字符", maxTemplateLength)
+	}
+	out, err := renderMessageTemplate(text, sampleMessageData(time.UTC))
+	if err != nil {
+		return fmt.Errorf("模板错误: %v", err)
+	}
+	return checkTemplateOutput(out)
+}
+
+// checkTemplateOutput 检查模板生成的消息, 未闭合的标记按普通字符发送, 只需检查内容不为空
+func checkTemplateOutput(out string) error {
+	if strings.TrimSpace(msgfmt.Parse(out).Plain()) == "" {
+		return errors.New("模板生成的消息为空")
+	}
+	return nil
+}
+
+// messageTemplate 订阅者使用的模板, 优先使用订阅者的模板, 其次是 feed 的模板
+func messageTemplate(sub *db.Subscribe, feedId string) string {
+	if sub != nil && sub.Template != "" {
+		return sub.Template
+	}
+	if feed, ok := FeedRegistryInstance().Get(feedId); ok && feed.Template != "" {
+		return feed.Template
+	}
+	return defaultMessageTemplate
+}
+
+// formatMessage 生成通知消息, 模板执行失败时使用内置模板
+func formatMessage(tmpl string, data messageData) string {
+	text, err := renderMessageTemplate(tmpl, data)
+	if err == nil {
+		err = checkTemplateOutput(text)
+	}
+	if err == nil {
+		return text
+	}
+	logx.Errorw("render message template failed, use default", logx.Field("err", err), logx.Field("template", tmpl))
+	text, _ = renderMessageTemplate(defaultMessageTemplate, data)
+	return text
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+	"ns-rss/src/app/msgfmt"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_formatMessage(t *testing.T) {
+	loc := subscriberLocation(nil)
+	published := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC).In(loc)
+	item := &gofeed.Item{Title: "出 港仔 *年付* [特价]", Description: "<b>10刀</b>", Categories: []string{"交易", "VPS"}}
+	match, _ := hasKeyword(item.Title, []string{"港仔 年付"})
+	data := newMessageData(item, "https://www.nodeseek.com/post-1~1", "ns", "NodeSeek", match, published)
+
+	// 内置模板加粗命中的关键字并显示命中的规则, 变量中的特殊字符已被转义
+	text := formatMessage(defaultMessageTemplate, data)
+	assert.Equal(t, "📢  出 *港仔* \\**年付*\\* \\[特价\\]\n\n🕐 2024-05-01 09:00:00\n\n👉 https://www.nodeseek.com/post-1~1\n\n🎯 命中规则: `港仔 年付`", text)
+	assert.Equal(t, "📢  出 *港仔* \\**年付*\\* \\[特价\\]\n\n🕐 2024\\-05\\-01 09:00:00\n\n👉 https://www\\.nodeseek\\.com/post\\-1\\~1\n\n🎯 命中规则: `港仔 年付`",
+		msgfmt.Parse(text).MarkdownV2())
+
+	// 没有命中信息时不显示规则
+	plain := newMessageData(item, "https://www.nodeseek.com/post-1~1", "ns", "NodeSeek", keywordMatch{}, published)
+	assert.Equal(t, "📢  出 港仔 \\*年付\\* \\[特价\\]\n\n🕐 2024-05-01 09:00:00\n\n👉 https://www.nodeseek.com/post-1~1",
+		formatMessage(defaultMessageTemplate, plain))
+
+	text = formatMessage(`*{{.FeedName}}* {{truncate 4 .Title}} {{.Published.Format "01-02 15:04"}} {{.Keyword}} {{.Description}} {{.Categories}}`, data)
+	assert.Equal(t, "*NodeSeek* 出 港… 05-01 09:00 港仔 年付 10刀 交易, VPS", text)
+
+	// 模板执行失败时使用内置模板
+	assert.Equal(t, formatMessage(defaultMessageTemplate, data), formatMessage("{{.Title.Foo}}", data))
+	assert.Equal(t, formatMessage(defaultMessageTemplate, data), formatMessage(`{{if eq .FeedId "ld"}}{{.Title}}{{end}}`, data))
+
+	// 模板中可以使用链接和代码, 变量中的 ) 不会提前结束链接
+	data.Link = msgfmt.Escape("https://example.com/a_(b)")
+	text = formatMessage("[{{truncate 3 .Title}}]({{.Link}}) `{{.Keyword}}`", data)
+	assert.Equal(t, msgfmt.New(msgfmt.Link("出 …", "https://example.com/a_(b)"), msgfmt.Plain(" "), msgfmt.Code("港仔 年付")), msgfmt.Parse(text))
+}
+
+func Test_highlightTitle(t *testing.T) {
+	assert.Equal(t, "*出* \\[港*仔*\\]", highlightTitle("出 [港仔]", []matchSpan{{0, 1}, {4, 5}}))
+	assert.Equal(t, "出 \\[港仔\\]", highlightTitle("出 [港仔]", nil))
+	// 位置超出标题时忽略
+	assert.Equal(t, "出", highlightTitle("出", []matchSpan{{0, 3}}))
+}
+
+func Test_ValidateMessageTemplate(t *testing.T) {
+	assert.NoError(t, ValidateMessageTemplate(defaultMessageTemplate))
+	for _, tmpl := range []string{
+		"*{{.FeedName}}* {{.Title}}\n{{.Link}}",
+		"*{{.Title}}",
+		"[{{.Title}}]({{.Link}})",
+		"`{{.Title}}`",
+	} {
+		assert.NoError(t, ValidateMessageTemplate(tmpl), tmpl)
+	}
+
+	for _, tmpl := range []string{
+		"",
+		"{{.Title",
+		"{{.Missing}}",
+		"{{if false}}{{.Title}}{{end}}",
+		"{{range $i := .Title}}{{end}}",
+		`{{define "a"}}{{template "a" .}}{{end}}{{template "a" .}}`,
+		strings.Repeat("a", maxTemplateLength+1),
+		`{{range $i, $c := "` + strings.Repeat("x", 500) + `"}}{{$.Link}}{{end}}`,
+	} {
+		assert.Error(t, ValidateMessageTemplate(tmpl), tmpl)
+	}
+}
+
+func Test_messageTemplate(t *testing.T) {
+	registry := feedRegistry
+	defer func() { feedRegistry = registry }()
+	feedRegistry = NewFeedRegistry()
+	feedRegistry.Apply([]db.FeedConfig{{FeedId: "ns", Template: "{{.Title}}"}, {FeedId: "ld"}})
+
+	assert.Equal(t, "{{.Title}}", messageTemplate(nil, "ns"))
+	assert.Equal(t, defaultMessageTemplate, messageTemplate(&db.Subscribe{}, "ld"))
+	assert.Equal(t, "*{{.Title}}*", messageTemplate(&db.Subscribe{Template: "*{{.Title}}*"}, "ns"))
+}
@@ -0,0 +1,143 @@
+package lib
+
+import (
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const metricsNamespace = "ns_feed"
+
+// 抓取结果
+const (
+	fetchResultSuccess     = "success"
+	fetchResultNotModified = "not_modified"
+	fetchResultError       = "error"
+)
+
+// 通知消息状态
+const (
+	messageEnqueued = "enqueued"
+	messageDropped  = "dropped"
+	messageSent     = "sent"
+	messageFailed   = "failed"
+)
+
+// 限流原因
+const (
+	rateLimitThrottled  = "throttled"   // 本地令牌桶限制, 消息被推迟
+	rateLimitRetryAfter = "retry_after" // Telegram 返回 429
+)
+
+var (
+	fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "RSS 抓取耗时, 按 feed 和结果区分",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"feed", "result"})
+
+	itemsParsed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "items_parsed_total",
+		Help:      "解析到的 RSS 条目数",
+	}, []string{"feed"})
+
+	feedMatches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "matches_total",
+		Help:      "命中关键字的条目数, 每个订阅者单独计数",
+	}, []string{"feed"})
+
+	messagesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_total",
+		Help:      "通知消息数, 按状态区分: enqueued、dropped、sent、failed",
+	}, []string{"status"})
+
+	rateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limited_total",
+		Help:      "因频率限制推迟发送的消息数, 按原因区分: throttled、retry_after",
+	}, []string{"reason"})
+
+	deadLettersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "dead_letters_total",
+		Help:      "写入死信表的消息数, 按失败类型区分: retryable(重试次数用完)、permanent、unreachable",
+	}, []string{"kind"})
+
+	webhookDeliveriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "webhook 投递次数, 按结果区分: succeeded、retried、failed",
+	}, []string{"result"})
+
+	telegramDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "telegram_request_duration_seconds",
+		Help:      "Telegram API 请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(fetchDuration, itemsParsed, feedMatches, messagesTotal, rateLimitedTotal, deadLettersTotal, webhookDeliveriesTotal, telegramDuration, subscriberCollector{})
+}
+
+func observeFetch(feedId string, start time.Time, result string) {
+	fetchDuration.WithLabelValues(feedId, result).Observe(time.Since(start).Seconds())
+}
+
+func observeTelegram(method string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	telegramDuration.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+}
+
+// subscriberCollector 抓取指标时统计订阅者数量
+type subscriberCollector struct{}
+
+var subscribersDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(metricsNamespace, "", "subscribers"),
+	"订阅者数量, 按状态和聊天类型区分",
+	[]string{"status", "type"}, nil,
+)
+
+func (subscriberCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- subscribersDesc
+}
+
+func (subscriberCollector) Collect(ch chan<- prometheus.Metric) {
+	type key struct{ status, chatType string }
+	counts := make(map[key]int)
+	for _, sub := range db.ListSubscribes() {
+		status := sub.Status
+		if status == "" {
+			status = "on"
+		}
+		counts[key{status: status, chatType: sub.Type}]++
+	}
+	for k, n := range counts {
+		ch <- prometheus.MustNewConstMetric(subscribersDesc, prometheus.GaugeValue, float64(n), k.status, k.chatType)
+	}
+}
+
+// registerQueueMetrics 注册消息队列长度指标, 即发件箱中待发送的消息数
+func (f *NsFeed) registerQueueMetrics() {
+	queueLength := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "message_queue_length",
+		Help:      "等待发送的通知消息数",
+	}, func() float64 {
+		return float64(f.outbox.count())
+	})
+	if err := prometheus.Register(queueLength); err != nil {
+		f.logger.Errorw("register queue metrics failed", logx.Field("err", err))
+	}
+}
@@ -0,0 +1,33 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNsFeed_AddMetrics(t *testing.T) {
+	f := NewNsFeed(context.Background(), nil, nil)
+	store := &memOutboxStore{}
+	f.outbox = store
+
+	enqueued := testutil.ToFloat64(messagesTotal.WithLabelValues(messageEnqueued))
+	dropped := testutil.ToFloat64(messagesTotal.WithLabelValues(messageDropped))
+	f.Add(NotifyMessage{Text: "1"})
+	// 写入发件箱失败时消息被丢弃
+	store.err = errors.New("database is locked")
+	f.Add(NotifyMessage{Text: "2"})
+
+	assert.Equal(t, enqueued+1, testutil.ToFloat64(messagesTotal.WithLabelValues(messageEnqueued)))
+	assert.Equal(t, dropped+1, testutil.ToFloat64(messagesTotal.WithLabelValues(messageDropped)))
+}
+
+func Test_observeFetch(t *testing.T) {
+	observeFetch("metrics_test", time.Now(), fetchResultSuccess)
+	observeFetch("metrics_test", time.Now(), fetchResultError)
+	assert.Equal(t, 2, testutil.CollectAndCount(fetchDuration))
+}
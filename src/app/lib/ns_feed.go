@@ -2,6 +2,7 @@ package lib
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"strings"
@@ -12,9 +13,7 @@ import (
 	"ns-rss/src/app/db"
 
 	"github.com/dlclark/regexp2"
-	"github.com/imroc/req/v3"
 	"github.com/mmcdole/gofeed"
-	"github.com/thoas/go-funk"
 	"github.com/zeromicro/go-zero/core/logx"
 	"github.com/zeromicro/go-zero/core/rescue"
 	"github.com/zeromicro/go-zero/core/threading"
@@ -27,141 +26,66 @@ import (
 
 type NsFeed struct {
 	sync.Mutex
-	ctx          context.Context
-	svc          *ServiceCtx
-	logger       logx.Logger
-	bot          BotNotifier
-	msgQueue     chan *NotifyMessage // 消息队列
-	Config       *config.Config
-	LastUpdate   time.Time
-	interval     time.Duration // 当前请求间隔
-	minInterval  time.Duration // 最小间隔
-	maxInterval  time.Duration // 最大间隔
-	successCount int           // 连续成功次数
-	failureCount int           // 连续失败次数
+	ctx            context.Context
+	svc            *ServiceCtx
+	logger         logx.Logger
+	bot            BotNotifier
+	outbox         outboxStore                        // 持久化的消息队列
+	outboxWake     chan struct{}                      // 有新消息时唤醒消费者
+	limiter        *sendLimiter                       // Telegram 发送频率限制
+	unreachable    func(chatId int64, err error)      // 聊天无法送达时的回调, 测试中可替换
+	targetNotifier func(id uint) (BotNotifier, error) // 按 id 创建其它推送目标的发送器, 测试中可替换
+	webhookWake    chan struct{}                      // 有新的 webhook 投递记录时唤醒投递协程
+	chatLocks      sync.Map                           // chatId -> *sync.Mutex, 同一聊天的通知历史检查和写入串行执行
+	Config         *config.Config
+	LastUpdate     time.Time
+	interval       time.Duration // 当前请求间隔
+	minInterval    time.Duration // 最小间隔
+	maxInterval    time.Duration // 最大间隔
+	successCount   int           // 连续成功次数
+	failureCount   int           // 连续失败次数
 }
 
 func NewNsFeed(ctx context.Context, svc *ServiceCtx, config *config.Config) *NsFeed {
+	interval := defaultFetchInterval(config)
 	return &NsFeed{
-		ctx:         ctx,
-		svc:         svc,
-		logger:      logx.WithContext(ctx).WithFields(logx.Field("lib", "ns_feed")),
-		Config:      config,
-		interval:    10 * time.Second,                // 初始间隔
-		minInterval: 10 * time.Second,                // 最小间隔
-		maxInterval: 5 * time.Minute,                 // 最大间隔
-		msgQueue:    make(chan *NotifyMessage, 1000), // 创建消息队列，缓冲大小为1000
+		ctx:            ctx,
+		svc:            svc,
+		logger:         logx.WithContext(ctx).WithFields(logx.Field("lib", "ns_feed")),
+		Config:         config,
+		interval:       interval,                // 初始间隔
+		minInterval:    interval,                // 最小间隔
+		maxInterval:    defaultMaxFetchInterval, // 最大间隔
+		outbox:         dbOutboxStore{},
+		outboxWake:     make(chan struct{}, 1),
+		limiter:        newSendLimiter(),
+		unreachable:    deactivateUnreachableSubscriber,
+		targetNotifier: loadTargetNotifier,
+		webhookWake:    make(chan struct{}, 1),
 	}
 }
 
 func (f *NsFeed) SetBot(bot BotNotifier) *NsFeed {
 	f.bot = bot
+	f.registerQueueMetrics()
 
-	// 启动消息队列消费者
-	go f.startQueueConsumer()
+	// 启动消息队列消费者和摘要推送
+	go f.startOutboxConsumer()
+	go f.startDigestScheduler()
 
 	return f
 }
 
-// 启动消息队列消费者，控制消费速率为每秒20条消息
-func (f *NsFeed) startQueueConsumer() {
-	defer rescue.Recover()
-
-	f.logger.Infow("starting message queue consumer with batching")
-
-	// 计算消息发送间隔，保证每秒最多发送20条消息
-	const interval = time.Millisecond * 50     // 1000ms / 20 = 50ms
-	const batchSize = 10                       // 批处理大小
-	const batchWindow = 500 * time.Millisecond // 批处理时间窗口
-
-	var messageBatch []*NotifyMessage
-	ticker := time.NewTicker(batchWindow)
-	defer ticker.Stop()
-
-	// 用于限制发送速率的时间点
-	nextSendTime := time.Now()
-
-	for {
-		select {
-		case <-f.ctx.Done():
-			f.logger.Infow("message queue consumer stopped due to context done")
-			return
-
-		case msg := <-f.msgQueue:
-			if msg != nil {
-				messageBatch = append(messageBatch, msg)
-			}
-
-			// 如果批次已满，立即处理
-			if len(messageBatch) >= batchSize {
-				now := time.Now()
-				// 如果已经到了可以发送的时间，处理批次
-				if now.After(nextSendTime) {
-					f.processBatch(messageBatch)
-					messageBatch = nil
-					nextSendTime = now.Add(interval * time.Duration(batchSize))
-				}
-			}
-
-		case <-ticker.C:
-			// 定期处理积累的消息，即使未达到批处理大小
-			if len(messageBatch) > 0 {
-				now := time.Now()
-				if now.After(nextSendTime) {
-					f.processBatch(messageBatch)
-					messageBatch = nil
-					nextSendTime = now.Add(interval * time.Duration(len(messageBatch)))
-				}
-			}
-		}
-	}
-}
-
-// 批量处理消息
-func (f *NsFeed) processBatch(messages []*NotifyMessage) {
-	if len(messages) == 0 || f.bot == nil {
-		return
-	}
-
-	// 按聊天ID分组
-	chatGroups := make(map[int64][]*NotifyMessage)
-	for _, msg := range messages {
-		if msg.ChatId != nil {
-			chatGroups[*msg.ChatId] = append(chatGroups[*msg.ChatId], msg)
-		}
-	}
-
-	// 对每个聊天ID的消息进行处理
-	for chatID, msgs := range chatGroups {
-		f.logger.Debugw("processing message batch", logx.Field("chatId", chatID), logx.Field("count", len(msgs)))
-
-		// 使用有限速率发送单条消息
-		for _, msg := range msgs {
-			f.bot.Notify(*msg)
-			time.Sleep(50 * time.Millisecond) // 控制发送速率
-		}
-	}
-}
-
+// Add 将消息写入发件箱, 由消费者按速率发送
 func (f *NsFeed) Add(msg NotifyMessage) {
-	// 将消息添加到队列
-	select {
-	case f.msgQueue <- &msg:
-		f.logger.Debugw("added message to queue", logx.Field("chatId", msg.ChatId))
-	default:
-		// 队列已满，记录日志
-		f.logger.Infow("message queue is full, message dropped", logx.Field("chatId", msg.ChatId))
-	}
-}
-
-func hasKeywordWithRegex(title string, keyword string) bool {
-	//尝试转为正则
-	re, err := regexp2.Compile(keyword, regexp2.IgnoreCase)
-	if err != nil {
-		return false
+	if err := f.outbox.add([]*db.Outbox{newOutbox(msg)}); err != nil {
+		messagesTotal.WithLabelValues(messageDropped).Inc()
+		f.logger.Errorw("add message to outbox failed, message dropped", logx.Field("err", err), logx.Field("chatId", msg.ChatId))
+		return
 	}
-	r, _ := re.MatchString(title)
-	return r
+	messagesTotal.WithLabelValues(messageEnqueued).Inc()
+	f.logger.Debugw("added message to outbox", logx.Field("chatId", msg.ChatId))
+	f.wakeOutbox()
 }
 
 // 使用缓存存储已编译的正则表达式
@@ -177,150 +101,67 @@ func getCachedRegex(keyword string) (*regexp2.Regexp, bool) {
 	if err != nil {
 		return nil, false
 	}
+	// 限制单次匹配时间, 防止灾难性回溯阻塞抓取协程
+	re.MatchTimeout = regexMatchTimeout
 
 	regexCache.Store(keyword, re)
 	return re, true
 }
 
-// 优化后的正则匹配函数
-func hasKeywordWithRegexCached(title string, keyword string) bool {
-	re, ok := getCachedRegex(keyword)
-	if !ok {
-		return false
-	}
-	r, _ := re.MatchString(title)
-	return r
+// hasKeyword 判断标题是否匹配任意一条关键字规则, 返回命中的规则及匹配的位置
+func hasKeyword(title string, keywords []string) (keywordMatch, bool) {
+	return matchKeywords(newTitleDoc(title), keywords)
 }
 
-func hasKeyword(title string, keywords []string) bool {
-	title = strings.ToLower(title)
+// matchKeywords 判断条目是否匹配任意一条关键字规则, 返回第一条命中的规则
+func matchKeywords(doc *matchDoc, keywords []string) (keywordMatch, bool) {
 	for _, keyword := range keywords {
-		// 检查是否包含特殊字符，判断是否需要正则匹配
-		needsRegex := strings.ContainsAny(keyword, "^$.*+?()[]{}|\\~+")
-
-		if !needsRegex {
-			// 简单的字符串包含检查
-			if strings.Contains(title, strings.ToLower(keyword)) {
-				return true
-			}
+		rule, err := getCachedRule(keyword)
+		if err != nil {
 			continue
 		}
-
-		// 首先尝试表达式匹配，这通常更快
-		if hasKeywordWithExpression(title, keyword) {
-			return true
-		}
-
-		// 如果表达式匹配失败，再尝试正则匹配
-		if hasKeywordWithRegexCached(title, keyword) {
-			return true
+		if match, ok := rule.find(doc); ok {
+			return match, true
 		}
 	}
-	return false
+	return keywordMatch{}, false
 }
 
-// matchExpression 匹配表达式函数
-// expr: 表达式字符串，支持 + (与), | (或), ~ (排除)
-// text: 要匹配的文本
-// 返回: 是否匹配的布尔值
-func matchExpression(expr, text string) bool {
-	// 首先处理 | (或) 运算符，将表达式按 | 分割
-	orParts := strings.Split(expr, "|")
-
-	// 任意一个 or 条件满足即返回 true
-	for _, orPart := range orParts {
-		if matchAndExpression(strings.TrimSpace(orPart), text) {
-			return true
-		}
-	}
-	return false
+type MessageOption struct {
+	ChatId   int64
+	FeedId   string
+	FeedName string
 }
 
-// matchAndExpression 处理 + (与) 和 ~ (排除) 的逻辑
-func matchAndExpression(expr, text string) bool {
-	// 将表达式按 + 分割
-	andParts := strings.Split(expr, "+")
+// feedEntry 抓取到的条目及其匹配内容, 同一批条目的匹配内容只构建一次
+type feedEntry struct {
+	item *gofeed.Item
+	doc  *matchDoc
+}
 
-	// 检查每个条件
-	for _, part := range andParts {
-		part = strings.TrimSpace(part)
-		if len(part) == 0 {
+func newFeedEntries(items []*gofeed.Item) []*feedEntry {
+	entries := make([]*feedEntry, 0, len(items))
+	for _, item := range items {
+		if item == nil {
 			continue
 		}
+		entries = append(entries, &feedEntry{item: item, doc: newMatchDoc(item)})
+	}
+	return entries
+}
 
-		// 处理排除(~)逻辑
-		if strings.HasPrefix(part, "~") {
-			excludeTerm := strings.TrimPrefix(part, "~")
-			if strings.Contains(text, excludeTerm) {
-				return false
-			}
-		} else {
-			// 处理包含逻辑
-			if !strings.Contains(text, part) {
-				return false
+// dispatchEntries 通过倒排索引一次性计算每个活跃订阅者命中的条目
+func dispatchEntries(feedId string, entries []*feedEntry, active map[int64]struct{}) map[int64][]*feedEntry {
+	idx := MatcherRegistryInstance().Index(feedId)
+	matched := make(map[int64][]*feedEntry)
+	for _, entry := range entries {
+		for chatId := range idx.match(entry.doc) {
+			if _, ok := active[chatId]; ok {
+				matched[chatId] = append(matched[chatId], entry)
 			}
 		}
 	}
-	return true
-}
-
-func hasKeywordWithExpression(title string, keyword string) bool {
-
-	return matchExpression(keyword, title)
-
-	// keyword = strings.Trim(keyword, "{}")
-	// keyword = strings.ToLower(keyword)
-	// // 处理或关系 (|)
-	// orParts := strings.Split(keyword, "|")
-	// if len(orParts) == 1 {
-	// 	return strings.Contains(title, keyword)
-	// }
-	// for _, orPart := range orParts {
-	// 	orPart = strings.TrimSpace(orPart)
-
-	// 	// 处理与关系 (+) 和非关系 (~)
-	// 	andParts := strings.Split(orPart, "+")
-	// 	allAndPartsMatch := true
-
-	// 	for _, andPart := range andParts {
-	// 		andPart = strings.TrimSpace(andPart)
-
-	// 		// 处理非关系 (~)
-	// 		notParts := strings.Split(andPart, "~")
-	// 		mainKeyword := strings.TrimSpace(notParts[0])
-
-	// 		// 检查主关键字是否存在
-	// 		if !strings.Contains(title, mainKeyword) {
-	// 			allAndPartsMatch = false
-	// 			break
-	// 		}
-
-	// 		// 检查排除关键字
-	// 		for i := 1; i < len(notParts); i++ {
-	// 			notKeyword := strings.TrimSpace(notParts[i])
-	// 			if strings.Contains(title, notKeyword) {
-	// 				allAndPartsMatch = false
-	// 				break
-	// 			}
-	// 		}
-
-	// 		if !allAndPartsMatch {
-	// 			break
-	// 		}
-	// 	}
-
-	// 	// 如果所有 AND 条件都匹配，返回 true
-	// 	if allAndPartsMatch {
-	// 		return true
-	// 	}
-	// }
-	// return false
-}
-
-type MessageOption struct {
-	ChatId   int64
-	FeedName string
-	Keywords []string
+	return matched
 }
 
 func removeHash(u string) (string, error) {
@@ -333,39 +174,66 @@ func removeHash(u string) (string, error) {
 	return parsedUrl.String(), nil
 }
 
-func (f *NsFeed) sendMessage(c *MessageOption, feedName string, items []*gofeed.Item) {
-	if len(items) == 0 {
-		return
+// lockChat 锁定单个聊天, 返回解锁函数
+func (f *NsFeed) lockChat(chatId int64) func() {
+	v, _ := f.chatLocks.LoadOrStore(chatId, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// sendMessage 通知订阅者, entries 为已命中关键字的条目, 返回新通知的条数
+func (f *NsFeed) sendMessage(c *MessageOption, feedName string, entries []*feedEntry) int {
+	if len(entries) == 0 {
+		return 0
 	}
 
-	// 1. 收集所有 URL 和符合关键词的条目
-	urls := make([]string, 0, len(items))
-	urlToItem := make(map[string]*gofeed.Item)
+	// 1. 收集所有 URL
+	urls := make([]string, 0, len(entries))
+	urlToEntry := make(map[string]*feedEntry)
 
-	for _, item := range items {
-		cleanUrl, err := removeHash(item.Link)
+	for _, entry := range entries {
+		cleanUrl, err := removeHash(entry.item.Link)
 		if err != nil || cleanUrl == "" {
 			continue
 		}
-
-		// 只处理符合关键词条件的条目
-		if hasKeyword(item.Title, c.Keywords) {
-			urls = append(urls, cleanUrl)
-			urlToItem[cleanUrl] = item
-		}
+		urls = append(urls, cleanUrl)
+		urlToEntry[cleanUrl] = entry
 	}
 
 	if len(urls) == 0 {
-		return
+		return 0
 	}
 
-	// 2. 批量查询已存在的通知
+	// 2. 批量查询已存在的通知, 同一聊天的多个 feed 同时命中同一链接时只通知一次
+	unlock := f.lockChat(c.ChatId)
+	defer unlock()
 	existingMap := db.GetNotifyHistoryBatch(c.ChatId, urls)
 
-	// 3. 处理新通知
+	// 3. 处理新通知, 摘要模式或免打扰暂存时先保存条目, 到时间后汇总推送
 	var newNotifications []*db.NotifyHistory
-
-	for url, item := range urlToItem {
+	var messages []*db.Outbox
+	var digestItems []*db.DigestItem
+	sub := SubCacheInstance().Get(c.ChatId)
+	now := time.Now()
+	digest := deliveryMode(sub) != db.DeliveryInstant || quietHold(sub, now)
+	silent := quietSilent(sub, now)
+	loc := subscriberLocation(sub)
+	// 聊天类型决定频率限制, 群组每分钟最多20条
+	var msgType string
+	if sub != nil {
+		msgType = sub.Type
+	}
+	var targets []db.NotifyTarget
+	if f.bot != nil && !digest {
+		targets = db.ListNotifyTargets(c.ChatId, true)
+	}
+
+	tmpl := messageTemplate(sub, c.FeedId)
+	matcher, _ := MatcherRegistryInstance().Get(c.FeedId, c.ChatId)
+
+	for url, entry := range urlToEntry {
+		item := entry.item
 		// 检查是否已存在
 		if existingMap[url] {
 			continue
@@ -378,49 +246,66 @@ func (f *NsFeed) sendMessage(c *MessageOption, feedName string, items []*gofeed.
 			Title:  item.Title,
 		})
 
+		if f.bot != nil && digest {
+			digestItems = append(digestItems, &db.DigestItem{
+				ChatId:      c.ChatId,
+				FeedId:      c.FeedId,
+				FeedName:    feedName,
+				Title:       item.Title,
+				Url:         url,
+				PublishedAt: item.PublishedParsed,
+			})
+			continue
+		}
+
 		// 发送消息
 		if f.bot != nil {
+			publishedAt := now
+			if item.PublishedParsed != nil {
+				publishedAt = *item.PublishedParsed
+			}
+			var match keywordMatch
+			if matcher != nil {
+				match, _ = matcher.matchRule(entry.doc)
+			}
+			data := newMessageData(item, url, c.FeedId, feedName, match, publishedAt.In(loc))
 			msg := NotifyMessage{
-				Text: fmt.Sprintf("📢  *%s*\n\n🕐 %s\n\n👉 %s",
-					item.Title,
-					item.PublishedParsed.Add(time.Hour*8).Format("2006-01-02 15:04:05"),
-					url),
-				ChatId: &c.ChatId,
+				Text:    formatMessage(tmpl, data),
+				ChatId:  &c.ChatId,
+				MsgType: msgType,
+				Silent:  silent,
+				Title:   item.Title,
+				Url:     url,
+				FeedId:  c.FeedId,
 			}
 
-			f.Add(msg)
+			messages = append(messages, withTargets(newOutbox(msg), targets, telegramEnabled(sub))...)
 		}
 	}
 
-	// 4. 批量插入新通知记录
+	// 4. 批量插入新通知记录, 待发送的消息或摘要条目在同一事务中写入
 	if len(newNotifications) > 0 {
-		err := db.AddNotifyHistoryBatch(newNotifications)
+		var err error
+		if digest {
+			err = db.AddNotifyHistoryWithDigest(newNotifications, digestItems)
+		} else {
+			err = db.AddNotifyHistoryWithOutbox(newNotifications, messages)
+		}
 		if err != nil {
+			messagesTotal.WithLabelValues(messageDropped).Add(float64(len(messages)))
 			f.logger.Errorw("批量添加通知历史失败", logx.Field("err", err), logx.Field("count", len(newNotifications)))
+			return 0
+		}
+		messagesTotal.WithLabelValues(messageEnqueued).Add(float64(len(messages)))
+		if len(messages) > 0 {
+			f.wakeOutbox()
 		}
 	}
+	return len(newNotifications)
 }
 
 var isRunning bool
 
-func (f *NsFeed) loadRssData(url string, ctx context.Context) (*gofeed.Feed, error) {
-	defer func() {
-		rescue.Recover()
-	}()
-	fp := gofeed.NewParser()
-	//fix:
-	if strings.Contains(url, "nodeloc_rss") {
-		return fp.ParseURLWithContext(url, ctx)
-	}
-	reqClient := req.C().ImpersonateChrome()
-	resp, err := reqClient.R().Get(url)
-	if err != nil {
-		return nil, err
-	}
-
-	return fp.ParseString(resp.String())
-}
-
 func (f *NsFeed) fetchRss() {
 	if isRunning {
 		fmt.Println("fetch rss is running")
@@ -443,11 +328,17 @@ func (f *NsFeed) fetchRss() {
 	var wg threading.RoutineGroup
 	for _, cnf := range feedCnf {
 		cnf := cnf
+		if cnf.Paused {
+			continue
+		}
 		wg.RunSafe(func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
-			feed, err := f.loadRssData(cnf.FeedUrl, ctx)
+			feed, _, err := f.loadRssData(&cnf, ctx)
+			if errors.Is(err, errNotModified) {
+				return
+			}
 			if err != nil {
 				f.logger.Errorw("fetch rss failed", logx.Field("err", err), logx.Field("feedUrl", cnf.FeedUrl))
 				return
@@ -460,6 +351,8 @@ func (f *NsFeed) fetchRss() {
 			for _, item := range feed.Items {
 				items = append(items, item)
 			}
+			RecentItemsInstance().Add(cnf.FeedId, items)
+			storeFeedItems(cnf.FeedId, items)
 			mux.Lock()
 			feedItems[cnf.FeedId] = items
 			mux.Unlock()
@@ -468,29 +361,27 @@ func (f *NsFeed) fetchRss() {
 	wg.Wait()
 
 	// 第二步：获取所有活跃订阅
-	subscribes := db.ListSubscribes()
-	subscribes = funk.Filter(subscribes, func(c *db.Subscribe) bool {
-		c.Status = strings.ToLower(c.Status)
-		c.Status = strings.TrimSpace(c.Status)
-		return c.Status == "on" || c.Status == ""
-	}).([]*db.Subscribe)
+	active := activeSubscribers()
 
 	// 第三步：使用工作池模式处理订阅消息
 	// 创建任务通道
 	type subscribeTask struct {
-		subscribe *db.Subscribe
-		feedId    string
-		items     []*gofeed.Item
+		chatId  int64
+		feedId  string
+		entries []*feedEntry
 	}
 
-	// 估算任务总数
-	taskCount := 0
-	for range subscribes {
-		for range feedItems {
-			taskCount++
+	var tasks []subscribeTask
+	for feedId, items := range feedItems {
+		matched := dispatchEntries(feedId, newFeedEntries(items), active)
+		for chatId, entries := range matched {
+			tasks = append(tasks, subscribeTask{chatId: chatId, feedId: feedId, entries: entries})
 		}
 	}
 
+	// 估算任务总数
+	taskCount := len(tasks)
+
 	// 创建任务通道，缓冲大小为任务总数
 	taskChan := make(chan subscribeTask, taskCount)
 
@@ -506,29 +397,18 @@ func (f *NsFeed) fetchRss() {
 			defer rescue.Recover()
 
 			for task := range taskChan {
-				subKeys := db.ListSubscribeFeedWith(task.subscribe.ChatId, task.feedId)
-				if subKeys.ID == 0 {
-					continue
-				}
-
 				f.sendMessage(&MessageOption{
-					ChatId:   task.subscribe.ChatId,
+					ChatId:   task.chatId,
+					FeedId:   task.feedId,
 					FeedName: task.feedId,
-					Keywords: subKeys.KeywordsArray,
-				}, task.feedId, task.items)
+				}, task.feedId, task.entries)
 			}
 		}()
 	}
 
 	// 分发任务
-	for _, subscribe := range subscribes {
-		for feedId, items := range feedItems {
-			taskChan <- subscribeTask{
-				subscribe: subscribe,
-				feedId:    feedId,
-				items:     items,
-			}
-		}
+	for _, task := range tasks {
+		taskChan <- task
 	}
 
 	// 关闭任务通道，表示没有更多任务
@@ -538,6 +418,18 @@ func (f *NsFeed) fetchRss() {
 	workerWg.Wait()
 }
 
+// activeSubscribers 返回开启了通知的订阅者
+func activeSubscribers() map[int64]struct{} {
+	active := make(map[int64]struct{})
+	for _, c := range db.ListSubscribes() {
+		status := strings.TrimSpace(strings.ToLower(c.Status))
+		if status == "on" || status == "" {
+			active[c.ChatId] = struct{}{}
+		}
+	}
+	return active
+}
+
 func (f *NsFeed) adjustInterval(rss string, success bool) {
 	f.Lock()
 	defer f.Unlock()
@@ -579,53 +471,69 @@ func (f *NsFeed) adjustInterval(rss string, success bool) {
 func (f *NsFeed) fetchRssAdaptive(feed *db.FeedConfig) error {
 	defer rescue.Recover()
 
-	resp, err := f.loadRssData(feed.FeedUrl, f.ctx)
+	start := time.Now()
+	resp, status, err := f.loadRssData(feed, f.ctx)
 
-	if err != nil || resp == nil {
+	// 304 内容未变化, 按成功处理
+	if errors.Is(err, errNotModified) {
+		observeFetch(feed.FeedId, start, fetchResultNotModified)
+		f.adjustInterval(feed.FeedUrl, true)
+		f.recordHealth(feed, status, 0, nil)
+		return nil
+	}
+
+	if err == nil && resp == nil {
+		err = errors.New("feed is nil")
+	}
+	if err != nil {
+		observeFetch(feed.FeedId, start, fetchResultError)
 		logx.Errorw("获取RSS失败",
 			logx.Field("err", err),
 			logx.Field("feedUrl", feed.FeedUrl),
 		)
 
 		f.adjustInterval(feed.FeedUrl, false)
+		f.recordHealth(feed, status, 0, err)
 		return err
 	}
 
 	// 请求成功
+	observeFetch(feed.FeedId, start, fetchResultSuccess)
+	itemsParsed.WithLabelValues(feed.FeedId).Add(float64(len(resp.Items)))
 	f.adjustInterval(feed.FeedUrl, true)
+	f.recordHealth(feed, status, len(resp.Items), nil)
 
 	if len(resp.Items) == 0 {
 		return nil
 	}
 
-	f.Lock()
-	defer f.Unlock()
+	// 保存最近条目, 供 /test 试运行关键字
+	RecentItemsInstance().Add(feed.FeedId, resp.Items)
+	storeFeedItems(feed.FeedId, resp.Items)
 
-	// 获取所有活跃订阅
-	subscribes := db.ListSubscribes()
-	subscribes = funk.Filter(subscribes, func(c *db.Subscribe) bool {
-		c.Status = strings.ToLower(c.Status)
-		c.Status = strings.TrimSpace(c.Status)
-		return c.Status == "on" || c.Status == ""
-	}).([]*db.Subscribe)
+	entries := newFeedEntries(resp.Items)
+	f.dispatchWebhooks(feed, entries)
 
-	if len(subscribes) == 0 {
-		return nil
-	}
+	// 通过倒排索引计算每个活跃订阅者命中的条目
+	matched := dispatchEntries(feed.FeedId, entries, activeSubscribers())
 
-	// 使用工作池模式处理订阅消息
-	// 创建任务通道
-	type subscribeTask struct {
-		subscribe *db.Subscribe
-		items     []*gofeed.Item
+	for _, entries := range matched {
+		feedMatches.WithLabelValues(feed.FeedId).Add(float64(len(entries)))
 	}
 
 	// 估算任务总数
-	taskCount := len(subscribes)
+	taskCount := len(matched)
 	if taskCount == 0 {
 		return nil
 	}
 
+	// 使用工作池模式处理订阅消息
+	// 创建任务通道
+	type subscribeTask struct {
+		chatId  int64
+		entries []*feedEntry
+	}
+
 	// 创建任务通道，缓冲大小为任务总数
 	taskChan := make(chan subscribeTask, taskCount)
 
@@ -641,25 +549,20 @@ func (f *NsFeed) fetchRssAdaptive(feed *db.FeedConfig) error {
 			defer rescue.Recover()
 
 			for task := range taskChan {
-				subKeys := db.ListSubscribeFeedWith(task.subscribe.ChatId, feed.FeedId)
-				if subKeys.ID == 0 {
-					continue
-				}
-
 				f.sendMessage(&MessageOption{
-					ChatId:   task.subscribe.ChatId,
+					ChatId:   task.chatId,
+					FeedId:   feed.FeedId,
 					FeedName: feed.Name,
-					Keywords: subKeys.KeywordsArray,
-				}, feed.Name, task.items)
+				}, feed.Name, task.entries)
 			}
 		}()
 	}
 
 	// 分发任务
-	for _, subscribe := range subscribes {
+	for chatId, entries := range matched {
 		taskChan <- subscribeTask{
-			subscribe: subscribe,
-			items:     resp.Items,
+			chatId:  chatId,
+			entries: entries,
 		}
 	}
 
@@ -672,33 +575,75 @@ func (f *NsFeed) fetchRssAdaptive(feed *db.FeedConfig) error {
 	return nil
 }
 
+// fetchTask 单个 feed 的抓取任务
+type fetchTask struct {
+	feed          db.FeedConfig
+	interval      time.Duration
+	minInterval   time.Duration
+	maxInterval   time.Duration
+	successCount  int
+	failureCount  int
+	nextFetchTime time.Time
+	running       bool // 正在抓取, 防止重复调度
+}
+
+// applySettings 更新抓取设置, 当前间隔限制在新的范围内
+func (t *fetchTask) applySettings(feed db.FeedConfig, settings fetchSettings) {
+	t.feed = feed
+	t.minInterval = settings.minInterval
+	t.maxInterval = settings.maxInterval
+	if t.interval < t.minInterval {
+		t.interval = t.minInterval
+	}
+	if t.interval > t.maxInterval {
+		t.interval = t.maxInterval
+	}
+}
+
 func (f *NsFeed) startAdaptiveFetch() {
 	// 创建一个工作池来处理RSS源的抓取
 	const workerCount = 3 // 工作协程数量，可以根据实际情况调整
 
-	// 创建任务通道
-	type fetchTask struct {
-		feed          db.FeedConfig
-		interval      time.Duration
-		minInterval   time.Duration
-		maxInterval   time.Duration
-		successCount  int
-		failureCount  int
-		nextFetchTime time.Time
-	}
-
-	// 初始化任务列表
-	var tasks []fetchTask
-	for _, feed := range db.ListAllFeedConfig() {
-		tasks = append(tasks, fetchTask{
+	var mu sync.Mutex
+	tasks := make(map[string]*fetchTask)
+
+	addOrUpdate := func(feed db.FeedConfig) {
+		settings := feedFetchSettings(&feed, f.Config)
+		mu.Lock()
+		defer mu.Unlock()
+		// 暂停的 feed 不再调度, 恢复后重新开始抓取
+		if feed.Paused {
+			delete(tasks, feed.FeedId)
+			return
+		}
+		if task, ok := tasks[feed.FeedId]; ok {
+			task.applySettings(feed, settings)
+			return
+		}
+		tasks[feed.FeedId] = &fetchTask{
 			feed:          feed,
-			interval:      10 * time.Second,
-			minInterval:   10 * time.Second,
-			maxInterval:   5 * time.Minute,
-			successCount:  0,
-			failureCount:  0,
+			interval:      settings.minInterval,
+			minInterval:   settings.minInterval,
+			maxInterval:   settings.maxInterval,
 			nextFetchTime: time.Now(),
-		})
+		}
+	}
+
+	// 订阅 feed 列表变更, 新增、修改、删除的 feed 立即生效
+	registry := FeedRegistryInstance()
+	registry.Subscribe(func(event FeedEvent, feed db.FeedConfig) {
+		switch event {
+		case FeedAdded, FeedUpdated:
+			addOrUpdate(feed)
+		case FeedRemoved:
+			mu.Lock()
+			delete(tasks, feed.FeedId)
+			mu.Unlock()
+		}
+	})
+	registry.Reload()
+	for _, feed := range registry.List() {
+		addOrUpdate(feed)
 	}
 
 	// 启动调度器
@@ -706,7 +651,7 @@ func (f *NsFeed) startAdaptiveFetch() {
 		defer rescue.Recover()
 
 		// 创建任务通道
-		taskChan := make(chan *fetchTask, len(tasks))
+		taskChan := make(chan *fetchTask, workerCount)
 
 		// 启动工作协程
 		var wg sync.WaitGroup
@@ -717,9 +662,15 @@ func (f *NsFeed) startAdaptiveFetch() {
 				defer rescue.Recover()
 
 				for task := range taskChan {
-					ctx := logx.ContextWithFields(context.Background(), logx.Field("rss", task.feed.FeedUrl))
+					mu.Lock()
+					feed := task.feed
+					mu.Unlock()
+
+					ctx := logx.ContextWithFields(context.Background(), logx.Field("rss", feed.FeedUrl))
+					err := f.fetchRssAdaptive(&feed)
 
-					if err := f.fetchRssAdaptive(&task.feed); err != nil {
+					mu.Lock()
+					if err != nil {
 						task.failureCount++
 						task.successCount = 0
 
@@ -750,8 +701,12 @@ func (f *NsFeed) startAdaptiveFetch() {
 						}
 					}
 
+					FeedHealthInstance().setInterval(&feed, task.interval)
+
 					// 更新下次抓取时间
 					task.nextFetchTime = time.Now().Add(task.interval)
+					task.running = false
+					mu.Unlock()
 				}
 			}()
 		}
@@ -771,16 +726,25 @@ func (f *NsFeed) startAdaptiveFetch() {
 				now := time.Now()
 
 				// 检查每个任务，如果到了执行时间就发送到任务通道
-				for i := range tasks {
-					if now.After(tasks[i].nextFetchTime) {
-						select {
-						case taskChan <- &tasks[i]:
-							// 临时设置下次执行时间为很久以后，防止重复调度
-							// 实际的下次执行时间会在任务完成后更新
-							tasks[i].nextFetchTime = now.Add(24 * time.Hour)
-						default:
-							// 任务通道已满，跳过
-						}
+				mu.Lock()
+				var due []*fetchTask
+				for _, task := range tasks {
+					if !task.running && now.After(task.nextFetchTime) {
+						// 先标记为运行中, 实际的下次执行时间会在任务完成后更新
+						task.running = true
+						due = append(due, task)
+					}
+				}
+				mu.Unlock()
+
+				for _, task := range due {
+					select {
+					case taskChan <- task:
+					default:
+						// 任务通道已满，下次再调度
+						mu.Lock()
+						task.running = false
+						mu.Unlock()
 					}
 				}
 			}
@@ -818,5 +782,29 @@ func (f *NsFeed) Start() {
 	//	}
 	//}()
 
+	nsFeed = f
+	MigrateStoredKeywords()
+	loadRecentItems()
+	f.startFeedItemCleanup()
 	f.startAdaptiveFetch()
+	f.startFeedReload()
+	go f.startWebhookConsumer()
+}
+
+// startFeedReload 定时同步 feed 列表
+func (f *NsFeed) startFeedReload() {
+	go func() {
+		defer rescue.Recover()
+
+		tk := time.NewTicker(feedReloadInterval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-tk.C:
+				FeedRegistryInstance().Reload()
+			}
+		}
+	}()
 }
@@ -1,12 +1,17 @@
 package lib
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"strings"
 	"testing"
-	
+	"time"
+
 	"github.com/imroc/req/v3"
 	"github.com/mmcdole/gofeed"
 	"github.com/stretchr/testify/assert"
+	"ns-rss/src/app/db"
 )
 
 func TestLinuxDoFeed(t *testing.T) {
@@ -20,10 +25,10 @@ func TestLinuxDoFeed(t *testing.T) {
 	feed, err := fp.ParseString(resp.String())
 	assert.NoError(t, err)
 	assert.NotNil(t, feed)
-	
+
 	for _, item := range feed.Items {
 		fmt.Println(item.Title+" "+item.Link, " ", item.Published)
-		
+
 	}
 }
 
@@ -93,16 +98,277 @@ func Test_hasKeyword(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "组合表达式匹配",
+			args: args{
+				title:    "出 iPhone 15 频道会员",
+				keywords: []string{"iPhone+频道~收"},
+			},
+			want: true,
+		},
+		{
+			name: "括号表达式匹配",
+			args: args{
+				title:    "[收]斯巴达小鸡一个",
+				keywords: []string{"(斯巴达 OR 港仔) AND NOT 收"},
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := hasKeyword(tt.args.title, tt.args.keywords); got != tt.want {
+			if _, got := hasKeyword(tt.args.title, tt.args.keywords); got != tt.want {
 				t.Errorf("hasKeyword() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+func Test_matchKeywords(t *testing.T) {
+	item := &gofeed.Item{
+		Title:       "出一台港仔 NAT",
+		Description: "<p>年付 <b>10u</b>, 可小刀</p>",
+		Author:      &gofeed.Person{Name: "cello"},
+		Categories:  []string{"交易"},
+	}
+	tests := []struct {
+		name     string
+		keywords []string
+		want     bool
+	}{
+		{name: "默认匹配标题", keywords: []string{"港仔"}, want: true},
+		{name: "默认不匹配正文", keywords: []string{"年付"}, want: false},
+		{name: "匹配正文", keywords: []string{"desc:年付"}, want: true},
+		{name: "正文去除html标签", keywords: []string{`desc:"年付 10u"`}, want: true},
+		{name: "匹配作者", keywords: []string{"author:cello"}, want: true},
+		{name: "匹配分类", keywords: []string{"cat:交易 AND 港仔"}, want: true},
+		{name: "分类不匹配", keywords: []string{"cat:技术 AND 港仔"}, want: false},
+		{name: "正则匹配正文", keywords: []string{`desc:年付\s*\d+u`}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := matchKeywords(newMatchDoc(item), tt.keywords)
+			assert.Equal(t, tt.want, ok)
+		})
+	}
+}
+
+func Test_matchKeywordsSpans(t *testing.T) {
+	item := &gofeed.Item{Title: "出港仔, 港仔 BOIL 年付", Description: "年付 10u"}
+	tests := []struct {
+		name     string
+		keywords []string
+		rule     string
+		spans    []matchSpan
+	}{
+		{name: "多次出现", keywords: []string{"港仔"}, rule: "港仔", spans: []matchSpan{{1, 3}, {5, 7}}},
+		{name: "返回第一条命中的规则", keywords: []string{"收", "boil NOT 收", "港仔"}, rule: "boil NOT 收", spans: []matchSpan{{8, 12}}},
+		{name: "NOT 中的关键字不计入", keywords: []string{"出 NOT (收 AND 港仔)"}, rule: "出 NOT (收 AND 港仔)", spans: []matchSpan{{0, 1}}},
+		{name: "OR 只计入命中的分支", keywords: []string{"收 OR 年付"}, rule: "收 OR 年付", spans: []matchSpan{{13, 15}}},
+		{name: "重叠的位置合并", keywords: []string{"港仔 \"港仔, 港\""}, rule: "港仔 \"港仔, 港\"", spans: []matchSpan{{1, 7}}},
+		{name: "正文命中没有标题位置", keywords: []string{"desc:10u"}, rule: "desc:10u", spans: nil},
+		{name: "正则", keywords: []string{`b.?il|年付$`}, rule: `b.?il|年付$`, spans: []matchSpan{{8, 12}, {13, 15}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, ok := matchKeywords(newMatchDoc(item), tt.keywords)
+			assert.True(t, ok)
+			assert.Equal(t, tt.rule, match.Rule)
+			assert.Equal(t, tt.spans, match.Spans)
+		})
+	}
+}
+
+func Test_matchKeywordsLegacy(t *testing.T) {
+	// 升级前保存的关键字新语法无法解析, 按原来的方式继续匹配
+	tests := []struct {
+		keyword string
+		title   string
+		want    bool
+	}{
+		{keyword: "收+", title: "收 港仔", want: true},
+		{keyword: "收+", title: "出 港仔", want: false},
+		{keyword: "C++", title: "C++ 入门", want: true},
+		{keyword: "C++", title: "Java 入门", want: false},
+		{keyword: "a||b", title: "随便什么标题", want: false},
+		{keyword: "a||b", title: "b 标题", want: true},
+		{keyword: "a+|b", title: "a 标题", want: true},
+		{keyword: "港仔+~收", title: "出 港仔", want: true},
+		{keyword: "港仔+~收", title: "收 港仔", want: false},
+		{keyword: "http://x.com", title: "镜像 http://x.com 可用", want: true},
+		{keyword: "http://x.com", title: "镜像 http://y.com", want: false},
+	}
+	for _, tt := range tests {
+		_, ok := matchKeywords(newTitleDoc(tt.title), []string{tt.keyword})
+		assert.Equal(t, tt.want, ok, "%s %s", tt.keyword, tt.title)
+	}
+
+	m := newSubscriptionMatcher(db.SubscribeConfig{ChatId: 1, FeedId: "ns", KeywordsArray: []string{"收+", "C++", "a||b"}})
+	assert.Len(t, m.rules, 3)
+	assert.True(t, m.match(newTitleDoc("收 港仔")))
+
+	// 新语法可以解析但含义不同的关键字, 记录为 legacy 后按原来的方式匹配
+	keywords := []string{"a.b", "(15|16)pro", "title:x", "港仔 年付"}
+	m = newSubscriptionMatcher(db.SubscribeConfig{ChatId: 1, FeedId: "ns", KeywordsArray: keywords, LegacyKeywordsArray: keywords})
+	assert.True(t, m.match(newTitleDoc("a-b")))
+	assert.True(t, m.match(newTitleDoc("iphone 16pro")))
+	assert.False(t, m.match(newTitleDoc("16 pro")))
+	assert.True(t, m.match(newTitleDoc("title:x")))
+	assert.False(t, m.match(newTitleDoc("x")))
+	assert.True(t, m.match(newTitleDoc("出 港仔 年付")))
+	assert.False(t, m.match(newTitleDoc("年付 港仔")))
+
+	// 未记录为 legacy 时按新语法匹配
+	m = newSubscriptionMatcher(db.SubscribeConfig{ChatId: 1, FeedId: "ns", KeywordsArray: keywords})
+	assert.False(t, m.match(newTitleDoc("a-b")))
+	assert.True(t, m.match(newTitleDoc("16 pro")))
+	assert.True(t, m.match(newTitleDoc("年付 港仔")))
+}
+
+func Test_legacyKeywordReason(t *testing.T) {
+	tests := []struct {
+		keyword string
+		legacy  bool
+	}{
+		{keyword: "港仔", legacy: false},
+		{keyword: "BGP", legacy: false},
+		{keyword: "Re:Zero", legacy: false},
+		{keyword: "港仔+出", legacy: false},
+		{keyword: "港仔|boil", legacy: false},
+		{keyword: "港仔+~收", legacy: false},
+		{keyword: "港仔+出|boil", legacy: false},
+		{keyword: "iphone.*pro", legacy: false},
+		{keyword: "(?=.*港仔)(?=.*出)", legacy: false},
+		{keyword: "a.b", legacy: true},
+		{keyword: "(15|16)pro", legacy: true},
+		{keyword: "title:x", legacy: true},
+		{keyword: `desc:年付\s*\d+`, legacy: true},
+		{keyword: "港仔 年付", legacy: true},
+		{keyword: `"港仔"`, legacy: true},
+		{keyword: "港仔 + 出", legacy: false},
+		{keyword: "收+", legacy: true},
+	}
+	for _, tt := range tests {
+		reason, legacy := legacyKeywordReason(tt.keyword)
+		assert.Equal(t, tt.legacy, legacy, "%s %s", tt.keyword, reason)
+		if legacy {
+			assert.NotEmpty(t, reason, tt.keyword)
+		}
+	}
+
+	legacy := checkStoredKeywords(db.SubscribeConfig{KeywordsArray: []string{"港仔", "a.b", "港仔 AND 出"}})
+	assert.Equal(t, []string{"a.b", "港仔 AND 出"}, legacy)
+}
+
+func Test_newSubscriptionMatcher(t *testing.T) {
+	m := newSubscriptionMatcher(db.SubscribeConfig{
+		ChatId:        1,
+		FeedId:        "ns",
+		KeywordsArray: []string{"a AND (b", "港仔~收", "desc:年付"},
+	})
+	// 语法错误的关键字按升级前的方式匹配
+	assert.Len(t, m.rules, 3)
+	assert.True(t, m.match(newTitleDoc("出港仔")))
+	assert.False(t, m.match(newTitleDoc("收港仔")))
+	assert.True(t, m.match(&matchDoc{title: "", desc: "年付 10u"}))
+}
+
+var benchVocab = []string{
+	"港仔", "boil", "斯巴达", "bgp", "探针", "搬瓦工", "dmit", "cmhk", "hkt", "nat",
+	"iphone", "youtube", "netflix", "claw", "ggy", "甲骨文", "aws", "azure", "vps", "独服",
+	"年付", "月付", "出", "收", "小鸡", "cn2", "gia", "9929", "4837", "rn",
+}
+
+// genSubscriptionMatchers 生成测试用的订阅, 约 10% 为表达式, 0.2% 为正则
+func genSubscriptionMatchers(r *rand.Rand, n int) []*subscriptionMatcher {
+	matchers := make([]*subscriptionMatcher, 0, n)
+	for i := 0; i < n; i++ {
+		var keywords []string
+		for j := 0; j < 5; j++ {
+			keywords = append(keywords, benchVocab[r.Intn(len(benchVocab))]+fmt.Sprint(r.Intn(20)))
+		}
+		switch {
+		case i%500 == 0:
+			keywords = append(keywords, fmt.Sprintf("(?=.*%s)(?=.*%s)", benchVocab[r.Intn(len(benchVocab))], benchVocab[r.Intn(len(benchVocab))]))
+		case i%10 == 0:
+			keywords = append(keywords, fmt.Sprintf("%s AND NOT %s", benchVocab[r.Intn(len(benchVocab))], benchVocab[r.Intn(len(benchVocab))]))
+		}
+		matchers = append(matchers, newSubscriptionMatcher(db.SubscribeConfig{
+			ChatId:        int64(i + 1),
+			FeedId:        "ns",
+			KeywordsArray: keywords,
+		}))
+	}
+	return matchers
+}
+
+func genTitles(r *rand.Rand, n int) []*matchDoc {
+	docs := make([]*matchDoc, 0, n)
+	for i := 0; i < n; i++ {
+		var words []string
+		for j := 0; j < 6; j++ {
+			words = append(words, benchVocab[r.Intn(len(benchVocab))]+fmt.Sprint(r.Intn(20)))
+		}
+		docs = append(docs, newTitleDoc(strings.Join(words, " ")))
+	}
+	return docs
+}
+
+func naiveMatch(matchers []*subscriptionMatcher, doc *matchDoc) map[int64]struct{} {
+	hits := make(map[int64]struct{})
+	for _, m := range matchers {
+		if m.match(doc) {
+			hits[m.ChatId] = struct{}{}
+		}
+	}
+	return hits
+}
+
+func Test_keywordIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	matchers := genSubscriptionMatchers(r, 500)
+	idx := newKeywordIndex(matchers)
+	for _, doc := range genTitles(r, 200) {
+		assert.Equal(t, naiveMatch(matchers, doc), idx.match(doc), doc.title)
+	}
+}
+
+func Test_ahoCorasick(t *testing.T) {
+	ac := newAhoCorasick([]string{"he", "she", "his", "hers", "港仔"})
+	found := make(map[int]int)
+	ac.find("ushers 出港仔", func(pattern int) {
+		found[pattern]++
+	})
+	assert.Equal(t, map[int]int{0: 1, 1: 1, 3: 1, 4: 1}, found)
+}
+
+// BenchmarkDispatch 10k 订阅者时倒排索引与逐个匹配的吞吐对比
+func BenchmarkDispatch(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	matchers := genSubscriptionMatchers(r, 10000)
+	docs := genTitles(r, 50)
+
+	b.Run("index", func(b *testing.B) {
+		idx := newKeywordIndex(matchers)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, doc := range docs {
+				idx.match(doc)
+			}
+		}
+		b.ReportMetric(float64(b.N*len(docs))/b.Elapsed().Seconds(), "items/s")
+	})
+
+	b.Run("naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, doc := range docs {
+				naiveMatch(matchers, doc)
+			}
+		}
+		b.ReportMetric(float64(b.N*len(docs))/b.Elapsed().Seconds(), "items/s")
+	})
+}
+
 //
 //func TestNsFeed_loadRssData(t *testing.T) {
 //
@@ -137,3 +403,28 @@ func Test_hasKeyword(t *testing.T) {
 //		})
 //	}
 //}
+
+func TestNsFeed_lockChat(t *testing.T) {
+	f := NewNsFeed(context.Background(), nil, nil)
+
+	unlock := f.lockChat(1)
+	// 其它聊天不受影响
+	f.lockChat(2)()
+
+	locked := make(chan struct{})
+	go func() {
+		defer f.lockChat(1)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("same chat should wait for the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("lock not released")
+	}
+}
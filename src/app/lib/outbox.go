@@ -0,0 +1,229 @@
+package lib
+
+import (
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/rescue"
+)
+
+const (
+	outboxPollInterval = 500 * time.Millisecond // 没有新消息唤醒时的轮询间隔
+	outboxBatchSize    = 10                     // 每次从数据库读取的消息数
+	outboxMaxWait      = 200 * time.Millisecond // 频率限制需要等待更久时推迟消息, 先发送其它聊天的消息
+	outboxRetention    = 7 * 24 * time.Hour     // 已发送消息的保留时长
+)
+
+// outboxStore 持久化待发送的消息, 测试中可替换
+type outboxStore interface {
+	add(messages []*db.Outbox) error
+	pending(limit int) []*db.Outbox
+	markSent(id uint) error
+	reschedule(id uint, at time.Time, reason string) error
+	retry(id uint, at time.Time, reason string) error
+	deadLetter(o *db.Outbox, reason string, permanent bool) error
+	deadLetterChat(chatId int64, reason string) (int64, error)
+	count() int64
+}
+
+type dbOutboxStore struct{}
+
+func (dbOutboxStore) add(messages []*db.Outbox) error { return db.AddOutbox(messages) }
+
+func (dbOutboxStore) pending(limit int) []*db.Outbox { return db.ListPendingOutbox(limit) }
+
+func (dbOutboxStore) markSent(id uint) error { return db.MarkOutboxSent(id) }
+
+func (dbOutboxStore) reschedule(id uint, at time.Time, reason string) error {
+	return db.RescheduleOutbox(id, at, reason)
+}
+
+func (dbOutboxStore) retry(id uint, at time.Time, reason string) error {
+	return db.RetryOutbox(id, at, reason)
+}
+
+func (dbOutboxStore) deadLetter(o *db.Outbox, reason string, permanent bool) error {
+	return db.MoveOutboxToDeadLetter(o, reason, permanent)
+}
+
+func (dbOutboxStore) deadLetterChat(chatId int64, reason string) (int64, error) {
+	return db.MoveChatOutboxToDeadLetter(chatId, reason)
+}
+
+func (dbOutboxStore) count() int64 { return db.CountPendingOutbox() }
+
+func newOutbox(msg NotifyMessage) *db.Outbox {
+	o := &db.Outbox{
+		Text:     msg.Text,
+		MsgType:  msg.MsgType,
+		Silent:   msg.Silent,
+		TargetId: msg.TargetId,
+		Title:    msg.Title,
+		Url:      msg.Url,
+		FeedId:   msg.FeedId,
+	}
+	if msg.ChatId != nil {
+		o.ChatId = *msg.ChatId
+	}
+	return o
+}
+
+// notifyMessage 发件箱中的消息, ChatId 为 0 时发送给管理员
+func notifyMessage(o *db.Outbox) NotifyMessage {
+	msg := NotifyMessage{
+		Text:     o.Text,
+		MsgType:  o.MsgType,
+		Silent:   o.Silent,
+		TargetId: o.TargetId,
+		Title:    o.Title,
+		Url:      o.Url,
+		FeedId:   o.FeedId,
+	}
+	if o.ChatId != 0 {
+		chatId := o.ChatId
+		msg.ChatId = &chatId
+	}
+	return msg
+}
+
+// wakeOutbox 通知消费者有新消息
+func (f *NsFeed) wakeOutbox() {
+	select {
+	case f.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// startOutboxConsumer 发送发件箱中的消息, 启动时继续发送上次未发送的消息
+func (f *NsFeed) startOutboxConsumer() {
+	defer rescue.Recover()
+
+	f.logger.Infow("starting outbox consumer", logx.Field("pending", f.outbox.count()))
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		f.drainOutbox()
+		select {
+		case <-f.ctx.Done():
+			f.logger.Infow("outbox consumer stopped due to context done")
+			return
+		case <-f.outboxWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainOutbox 发送所有已到发送时间的消息, 受频率限制的消息推迟到预定的发送时间
+func (f *NsFeed) drainOutbox() {
+	for {
+		messages := f.outbox.pending(outboxBatchSize)
+		if len(messages) == 0 {
+			return
+		}
+		for _, o := range messages {
+			if f.ctx.Err() != nil {
+				return
+			}
+			// 推迟过的消息已经预定了发送时间, 不再重复消耗令牌
+			// 其它推送目标不受 Telegram 的频率限制
+			at := time.Now()
+			if !o.Reserved && o.TargetId == 0 {
+				at = f.limiter.reserve(o.ChatId, o.MsgType, at)
+			}
+
+			wait := time.Until(at)
+			if wait > outboxMaxWait {
+				rateLimitedTotal.WithLabelValues(rateLimitThrottled).Inc()
+				if err := f.outbox.reschedule(o.ID, at, ""); err != nil {
+					f.logger.Errorw("reschedule outbox message failed", logx.Field("err", err), logx.Field("id", o.ID))
+					return
+				}
+				continue
+			}
+			if wait > 0 {
+				time.Sleep(wait)
+			}
+			// 状态无法更新时停止本轮发送, 避免重复发送同一条消息
+			if err := f.deliver(o); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// deliver 发送一条消息并更新状态, 返回更新状态的错误
+func (f *NsFeed) deliver(o *db.Outbox) error {
+	var err error
+	if o.TargetId != 0 {
+		var notifier BotNotifier
+		if notifier, err = f.targetNotifier(o.TargetId); err == nil {
+			err = notifier.Notify(notifyMessage(o))
+		}
+	} else if f.bot != nil {
+		err = f.bot.Notify(notifyMessage(o))
+	}
+	if d, ok := retryAfter(err); ok && o.TargetId == 0 {
+		// 429 时暂停向该聊天发送, 消息重新预定暂停结束后的发送时间
+		// 其它推送目标的 429 与该聊天的 Telegram 频率无关, 按普通错误退避重试
+		rateLimitedTotal.WithLabelValues(rateLimitRetryAfter).Inc()
+		f.logger.Infow("telegram rate limited, retry later", logx.Field("retryAfter", d), logx.Field("id", o.ID), logx.Field("chatId", o.ChatId))
+		now := time.Now()
+		f.limiter.pause(o.ChatId, o.MsgType, now, now.Add(d))
+		at := f.limiter.reserve(o.ChatId, o.MsgType, now)
+		err = f.outbox.reschedule(o.ID, at, err.Error())
+	} else if err != nil {
+		err = f.handleSendError(o, err)
+	} else {
+		err = f.outbox.markSent(o.ID)
+	}
+	if err != nil {
+		f.logger.Errorw("update outbox status failed", logx.Field("err", err), logx.Field("id", o.ID))
+	}
+	return err
+}
+
+// handleSendError 可重试的错误按指数退避重试, 永久错误和重试次数用完的消息写入死信表
+func (f *NsFeed) handleSendError(o *db.Outbox, sendErr error) error {
+	kind := classifySendError(sendErr)
+	reason := sendErr.Error()
+	f.logger.Errorw("send outbox message failed", logx.Field("err", sendErr), logx.Field("kind", kind.String()),
+		logx.Field("id", o.ID), logx.Field("chatId", o.ChatId), logx.Field("attempts", o.Attempts+1))
+
+	if kind == sendRetryable && o.Attempts+1 < maxSendAttempts {
+		return f.outbox.retry(o.ID, time.Now().Add(retryBackoff(o.Attempts+1)), reason)
+	}
+
+	if err := f.outbox.deadLetter(o, reason, kind != sendRetryable); err != nil {
+		return err
+	}
+	deadLettersTotal.WithLabelValues(kind.String()).Inc()
+
+	if kind == sendUnreachable && o.ChatId != 0 && o.TargetId == 0 {
+		// 聊天已无法送达, 剩余的消息不再发送
+		if n, err := f.outbox.deadLetterChat(o.ChatId, reason); err != nil {
+			f.logger.Errorw("move chat outbox to dead letter failed", logx.Field("err", err), logx.Field("chatId", o.ChatId))
+		} else if n > 0 {
+			deadLettersTotal.WithLabelValues(kind.String()).Add(float64(n))
+		}
+		if f.unreachable != nil {
+			f.unreachable(o.ChatId, sendErr)
+		}
+	}
+	return nil
+}
+
+// cleanupOutbox 删除过期的已发送消息
+func (f *NsFeed) cleanupOutbox() {
+	f.limiter.cleanup(time.Now())
+
+	n, err := db.DeleteOutboxBefore(time.Now().Add(-outboxRetention))
+	if err != nil {
+		f.logger.Errorw("delete sent outbox messages failed", logx.Field("err", err))
+	} else if n > 0 {
+		f.logger.Infow("delete sent outbox messages", logx.Field("count", n))
+	}
+}
@@ -0,0 +1,337 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// memOutboxStore 内存中的发件箱
+type memOutboxStore struct {
+	mu       sync.Mutex
+	nextId   uint
+	messages []*db.Outbox
+	dead     []*db.Outbox
+	err      error
+}
+
+func (s *memOutboxStore) add(messages []*db.Outbox) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	for _, m := range messages {
+		s.nextId++
+		m.ID = s.nextId
+		m.Status = db.OutboxPending
+		s.messages = append(s.messages, m)
+	}
+	return nil
+}
+
+func (s *memOutboxStore) pending(limit int) []*db.Outbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []*db.Outbox
+	for _, m := range s.messages {
+		if m.Status == db.OutboxPending && !m.NextAttemptAt.After(time.Now()) && len(result) < limit {
+			c := *m
+			result = append(result, &c)
+		}
+	}
+	return result
+}
+
+func (s *memOutboxStore) setStatus(id uint, status, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.messages {
+		if m.ID == id {
+			m.Status = status
+			m.LastError = reason
+			m.Attempts++
+		}
+	}
+	return nil
+}
+
+func (s *memOutboxStore) markSent(id uint) error { return s.setStatus(id, db.OutboxSent, "") }
+
+func (s *memOutboxStore) retry(id uint, at time.Time, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.messages[id-1]
+	m.Attempts++
+	m.NextAttemptAt = at
+	m.Reserved = false
+	m.LastError = reason
+	return nil
+}
+
+func (s *memOutboxStore) deadLetter(o *db.Outbox, reason string, permanent bool) error {
+	if err := s.setStatus(o.ID, db.OutboxFailed, reason); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dead = append(s.dead, s.messages[o.ID-1])
+	return nil
+}
+
+func (s *memOutboxStore) deadLetterChat(chatId int64, reason string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, m := range s.messages {
+		if m.ChatId == chatId && m.TargetId == 0 && m.Status == db.OutboxPending {
+			m.Status = db.OutboxFailed
+			m.LastError = reason
+			s.dead = append(s.dead, m)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memOutboxStore) reschedule(id uint, at time.Time, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.messages[id-1]
+	m.NextAttemptAt = at
+	m.Reserved = true
+	m.LastError = reason
+	return nil
+}
+
+func (s *memOutboxStore) count() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, m := range s.messages {
+		if m.Status == db.OutboxPending {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *memOutboxStore) status(id uint) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages[id-1].Status
+}
+
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []NotifyMessage
+	fail map[string]error
+}
+
+func (n *fakeNotifier) Notify(msg NotifyMessage) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.fail[msg.Text]; err != nil {
+		delete(n.fail, msg.Text)
+		return err
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func TestNsFeed_drainOutbox(t *testing.T) {
+	store := &memOutboxStore{}
+	bot := &fakeNotifier{fail: map[string]error{
+		"bad": &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"},
+	}}
+	f := NewNsFeed(context.Background(), nil, nil)
+	f.outbox = store
+	f.bot = bot
+	var unreachable []int64
+	f.unreachable = func(chatId int64, err error) {
+		unreachable = append(unreachable, chatId)
+	}
+
+	chatId, other := int64(100), int64(200)
+	// 模拟重启前未发送的消息
+	assert.NoError(t, store.add([]*db.Outbox{
+		newOutbox(NotifyMessage{Text: "a", ChatId: &chatId}),
+		newOutbox(NotifyMessage{Text: "bad", ChatId: &other}),
+		newOutbox(NotifyMessage{Text: "admin"}),
+		newOutbox(NotifyMessage{Text: "bad2", ChatId: &other}),
+	}))
+	assert.Equal(t, int64(4), store.count())
+
+	f.drainOutbox()
+
+	assert.Equal(t, int64(0), store.count())
+	assert.Equal(t, db.OutboxSent, store.status(1))
+	assert.Equal(t, db.OutboxFailed, store.status(2))
+	assert.Equal(t, db.OutboxSent, store.status(3))
+	// 聊天无法送达后, 剩余的消息直接写入死信表
+	assert.Equal(t, db.OutboxFailed, store.status(4))
+	assert.Len(t, store.dead, 2)
+	assert.Equal(t, []int64{other}, unreachable)
+	if assert.Len(t, bot.sent, 2) {
+		assert.Equal(t, chatId, *bot.sent[0].ChatId)
+		assert.Nil(t, bot.sent[1].ChatId)
+	}
+}
+
+func TestNsFeed_drainOutboxRetry(t *testing.T) {
+	store := &memOutboxStore{}
+	f := NewNsFeed(context.Background(), nil, nil)
+	f.outbox = store
+	f.bot = &fakeNotifier{fail: map[string]error{"a": errors.New("connection reset by peer")}}
+
+	chatId := int64(1)
+	assert.NoError(t, store.add([]*db.Outbox{newOutbox(NotifyMessage{Text: "a", ChatId: &chatId})}))
+
+	start := time.Now()
+	f.drainOutbox()
+
+	// 网络错误稍后重试
+	m := store.messages[0]
+	assert.Equal(t, db.OutboxPending, m.Status)
+	assert.Equal(t, 1, m.Attempts)
+	assert.WithinDuration(t, start.Add(baseRetryBackoff), m.NextAttemptAt, time.Second)
+
+	// 重试次数用完后写入死信表
+	m.Attempts = maxSendAttempts - 1
+	m.NextAttemptAt = time.Time{}
+	f.limiter = newSendLimiter()
+	f.bot = &fakeNotifier{fail: map[string]error{"a": errors.New("connection reset by peer")}}
+	f.drainOutbox()
+	assert.Equal(t, db.OutboxFailed, m.Status)
+	assert.Len(t, store.dead, 1)
+}
+
+func TestNsFeed_outboxConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &memOutboxStore{}
+	bot := &fakeNotifier{}
+	f := NewNsFeed(ctx, nil, nil)
+	f.outbox = store
+	f.bot = bot
+	go f.startOutboxConsumer()
+
+	chatId := int64(1)
+	f.Add(NotifyMessage{Text: "hello", ChatId: &chatId})
+
+	assert.Eventually(t, func() bool {
+		return store.count() == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, db.OutboxSent, store.status(1))
+}
+
+func TestNsFeed_drainOutboxRateLimit(t *testing.T) {
+	store := &memOutboxStore{}
+	bot := &fakeNotifier{fail: map[string]error{
+		"b": &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 5}},
+	}}
+	f := NewNsFeed(context.Background(), nil, nil)
+	f.outbox = store
+	f.bot = bot
+
+	chatId, other := int64(1), int64(2)
+	assert.NoError(t, store.add([]*db.Outbox{
+		newOutbox(NotifyMessage{Text: "a", ChatId: &chatId}),
+		newOutbox(NotifyMessage{Text: "a2", ChatId: &chatId}),
+		newOutbox(NotifyMessage{Text: "b", ChatId: &other}),
+		newOutbox(NotifyMessage{Text: "b2", ChatId: &other}),
+	}))
+
+	start := time.Now()
+	f.drainOutbox()
+
+	// 同一聊天每秒1条, 第二条推迟约1s, 不阻塞其它聊天
+	if assert.Len(t, bot.sent, 1) {
+		assert.Equal(t, "a", bot.sent[0].Text)
+	}
+	assert.Equal(t, int64(3), store.count())
+	assert.WithinDuration(t, start.Add(time.Second), store.messages[1].NextAttemptAt, 200*time.Millisecond)
+	// 429 后按 retry_after 推迟, 同一聊天的后续消息排在其后
+	assert.WithinDuration(t, start.Add(5*time.Second), store.messages[2].NextAttemptAt, 200*time.Millisecond)
+	assert.True(t, store.messages[3].NextAttemptAt.After(store.messages[2].NextAttemptAt))
+	assert.Contains(t, store.messages[2].LastError, "Too Many Requests")
+}
+
+func TestNsFeed_drainOutboxTargets(t *testing.T) {
+	store := &memOutboxStore{}
+	bot := &fakeNotifier{}
+	targets := map[uint]*fakeNotifier{
+		1: {},
+		2: {fail: map[string]error{"a": &notifyStatusError{Kind: db.TargetDiscord, Status: 404}}},
+	}
+	f := NewNsFeed(context.Background(), nil, nil)
+	f.outbox = store
+	f.bot = bot
+	f.targetNotifier = func(id uint) (BotNotifier, error) {
+		if n, ok := targets[id]; ok {
+			return n, nil
+		}
+		return nil, errTargetUnavailable
+	}
+	var unreachable []int64
+	f.unreachable = func(chatId int64, err error) {
+		unreachable = append(unreachable, chatId)
+	}
+
+	chatId := int64(1)
+	var messages []*db.Outbox
+	for _, text := range []string{"a", "a2"} {
+		o := newOutbox(NotifyMessage{Text: text, ChatId: &chatId})
+		messages = append(messages, withTargets(o, []db.NotifyTarget{{ID: 1}, {ID: 2}, {ID: 3}}, true)...)
+	}
+	assert.NoError(t, store.add(messages))
+
+	f.drainOutbox()
+
+	// Telegram 受每秒1条的限制, 其它推送目标不受影响
+	assert.Len(t, bot.sent, 1)
+	if assert.Len(t, targets[1].sent, 2) {
+		assert.Equal(t, uint(1), targets[1].sent[0].TargetId)
+	}
+	assert.Len(t, targets[2].sent, 1)
+	// 推送目标的错误不会停用订阅者
+	assert.Len(t, store.dead, 3)
+	assert.Empty(t, unreachable)
+	assert.Equal(t, int64(1), store.count())
+}
+
+func TestNsFeed_drainOutboxTargetRateLimit(t *testing.T) {
+	store := &memOutboxStore{}
+	bot := &fakeNotifier{}
+	target := &fakeNotifier{fail: map[string]error{
+		"a": &tgbotapi.Error{Code: 429, Message: "Too Many Requests", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 30}},
+	}}
+	f := NewNsFeed(context.Background(), nil, nil)
+	f.outbox = store
+	f.bot = bot
+	f.targetNotifier = func(id uint) (BotNotifier, error) { return target, nil }
+
+	chatId := int64(1)
+	o := newOutbox(NotifyMessage{Text: "a", ChatId: &chatId})
+	o.TargetId = 1
+	assert.NoError(t, store.add([]*db.Outbox{o, newOutbox(NotifyMessage{Text: "b", ChatId: &chatId})}))
+
+	start := time.Now()
+	f.drainOutbox()
+
+	// 推送目标的 429 按退避重试, 不暂停向该聊天发送 Telegram 消息
+	assert.Equal(t, 1, store.messages[0].Attempts)
+	assert.False(t, store.messages[0].Reserved)
+	assert.WithinDuration(t, start.Add(retryBackoff(1)), store.messages[0].NextAttemptAt, 200*time.Millisecond)
+	if assert.Len(t, bot.sent, 1) {
+		assert.Equal(t, "b", bot.sent[0].Text)
+	}
+}
@@ -0,0 +1,138 @@
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // 运行环境可能没有时区数据
+
+	"ns-rss/src/app/db"
+)
+
+var locationCache sync.Map // 时区名称 -> *time.Location
+
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locationCache.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locationCache.Store(name, loc)
+	return loc, nil
+}
+
+// subscriberLocation 订阅者的时区, 未设置或无效时使用默认时区
+func subscriberLocation(sub *db.Subscribe) *time.Location {
+	if sub != nil && sub.Timezone != "" {
+		if loc, err := loadLocation(sub.Timezone); err == nil {
+			return loc
+		}
+	}
+	loc, err := loadLocation(db.DefaultTimezone)
+	if err != nil {
+		return time.FixedZone("CST", 8*3600)
+	}
+	return loc
+}
+
+// parseTimezone 解析时区, 支持 IANA 名称(如 Asia/Tokyo)和 UTC+8 这样的整点偏移
+func parseTimezone(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	upper := strings.ToUpper(s)
+	for _, prefix := range []string{"UTC", "GMT"} {
+		if !strings.HasPrefix(upper, prefix) || len(upper) == len(prefix) {
+			continue
+		}
+		offset, err := strconv.Atoi(strings.TrimPrefix(upper[len(prefix):], "+"))
+		if err != nil || offset < -12 || offset > 14 {
+			return "", fmt.Errorf("时区 %s 无效, 偏移需要是 -12 到 +14 之间的整数", s)
+		}
+		if offset == 0 {
+			return "UTC", nil
+		}
+		// Etc/GMT 时区的符号与 UTC 偏移相反
+		return fmt.Sprintf("Etc/GMT%+d", -offset), nil
+	}
+	if _, err := loadLocation(s); err != nil || s == "" || strings.EqualFold(s, "local") {
+		return "", fmt.Errorf("时区 %s 无效, 请使用 Asia/Shanghai 这样的时区名称或 UTC+8", s)
+	}
+	return s, nil
+}
+
+// parseClockTime 解析 HH:MM 格式的时间
+func parseClockTime(s string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, 0, errors.New("时间格式错误, 请使用 HH:MM, 例如 09:00")
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// parseQuietHours 解析 00:00-08:00 格式的免打扰时段
+func parseQuietHours(s string) (start, end string, err error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 2 {
+		return "", "", errors.New("免打扰时段格式错误, 例如: 00:00-08:00")
+	}
+	var clock [2]string
+	for i, part := range parts {
+		hour, minute, err := parseClockTime(part)
+		if err != nil {
+			return "", "", err
+		}
+		clock[i] = fmt.Sprintf("%02d:%02d", hour, minute)
+	}
+	if clock[0] == clock[1] {
+		return "", "", errors.New("免打扰的开始和结束时间不能相同")
+	}
+	return clock[0], clock[1], nil
+}
+
+// inQuietHours 当前是否处于订阅者的免打扰时段, 支持跨越零点的时段
+func inQuietHours(sub *db.Subscribe, now time.Time) bool {
+	if sub == nil || sub.QuietStart == "" || sub.QuietEnd == "" {
+		return false
+	}
+	startHour, startMinute, err := parseClockTime(sub.QuietStart)
+	if err != nil {
+		return false
+	}
+	endHour, endMinute, err := parseClockTime(sub.QuietEnd)
+	if err != nil {
+		return false
+	}
+	start, end := startHour*60+startMinute, endHour*60+endMinute
+	t := now.In(subscriberLocation(sub))
+	m := t.Hour()*60 + t.Minute()
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// quietHold 免打扰时段内暂存消息, 结束后汇总推送
+func quietHold(sub *db.Subscribe, now time.Time) bool {
+	return inQuietHours(sub, now) && sub.QuietMode != db.QuietSilent
+}
+
+// quietSilent 免打扰时段内照常推送, 但不发出提醒
+func quietSilent(sub *db.Subscribe, now time.Time) bool {
+	return inQuietHours(sub, now) && sub.QuietMode == db.QuietSilent
+}
+
+// quietHoursText 免打扰设置的说明
+func quietHoursText(sub *db.Subscribe) string {
+	if sub.QuietStart == "" || sub.QuietEnd == "" {
+		return "未开启"
+	}
+	mode := "暂存, 结束后汇总推送"
+	if sub.QuietMode == db.QuietSilent {
+		mode = "静默推送, 不发出提醒"
+	}
+	return fmt.Sprintf("%s-%s, %s", sub.QuietStart, sub.QuietEnd, mode)
+}
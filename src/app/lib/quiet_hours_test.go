@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_parseTimezone(t *testing.T) {
+	tz, err := parseTimezone("Asia/Tokyo")
+	assert.NoError(t, err)
+	assert.Equal(t, "Asia/Tokyo", tz)
+
+	// Etc/GMT 的符号与 UTC 偏移相反
+	tz, err = parseTimezone("UTC+8")
+	assert.NoError(t, err)
+	assert.Equal(t, "Etc/GMT-8", tz)
+	tz, err = parseTimezone("gmt-5")
+	assert.NoError(t, err)
+	assert.Equal(t, "Etc/GMT+5", tz)
+	tz, err = parseTimezone("UTC+0")
+	assert.NoError(t, err)
+	assert.Equal(t, "UTC", tz)
+
+	for _, s := range []string{"", "Local", "Mars/Base", "UTC+15", "UTC+8:30"} {
+		_, err = parseTimezone(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func Test_inQuietHours(t *testing.T) {
+	sub := &db.Subscribe{Timezone: "Asia/Shanghai", QuietStart: "23:00", QuietEnd: "07:30"}
+	loc := subscriberLocation(sub)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 5, 1, hour, minute, 0, 0, loc)
+	}
+
+	// 跨越零点的时段
+	assert.True(t, inQuietHours(sub, at(23, 0)))
+	assert.True(t, inQuietHours(sub, at(2, 0)))
+	assert.True(t, inQuietHours(sub, at(7, 29)))
+	assert.False(t, inQuietHours(sub, at(7, 30)))
+	assert.False(t, inQuietHours(sub, at(12, 0)))
+
+	sub.QuietStart, sub.QuietEnd = "12:00", "14:00"
+	assert.True(t, inQuietHours(sub, at(13, 0)))
+	assert.False(t, inQuietHours(sub, at(14, 0)))
+
+	// 按订阅者的时区计算, 东京 13:00 是上海 12:00
+	sub.Timezone = "Asia/Tokyo"
+	assert.True(t, inQuietHours(sub, at(12, 30)))
+	assert.False(t, inQuietHours(sub, at(10, 30)))
+
+	assert.True(t, quietHold(sub, at(12, 30)))
+	sub.QuietMode = db.QuietSilent
+	assert.False(t, quietHold(sub, at(12, 30)))
+	assert.True(t, quietSilent(sub, at(12, 30)))
+
+	sub.QuietStart, sub.QuietEnd = "", ""
+	assert.False(t, inQuietHours(sub, at(12, 30)))
+	assert.False(t, inQuietHours(nil, at(12, 30)))
+}
+
+func Test_subscriberLocation(t *testing.T) {
+	published := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2024-05-01 09:00", published.In(subscriberLocation(nil)).Format("2006-01-02 15:04"))
+	assert.Equal(t, "2024-04-30 21:00", published.In(subscriberLocation(&db.Subscribe{Timezone: "America/New_York"})).Format("2006-01-02 15:04"))
+	// 无效时区使用默认时区
+	assert.Equal(t, "2024-05-01 09:00", published.In(subscriberLocation(&db.Subscribe{Timezone: "bad"})).Format("2006-01-02 15:04"))
+}
+
+func Test_parseQuietHours(t *testing.T) {
+	start, end, err := parseQuietHours("23:00-7:30")
+	assert.NoError(t, err)
+	assert.Equal(t, "23:00", start)
+	assert.Equal(t, "07:30", end)
+
+	for _, s := range []string{"23:00", "23:00-23:00", "25:00-07:00", "a-b"} {
+		_, _, err = parseQuietHours(s)
+		assert.Error(t, err, s)
+	}
+}
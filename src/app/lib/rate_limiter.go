@@ -0,0 +1,153 @@
+package lib
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Telegram 的发送频率限制
+const (
+	globalSendRate = 30               // 全局每秒最多30条
+	chatSendRate   = 1                // 同一聊天每秒最多1条
+	groupSendRate  = 20.0 / 60        // 同一群组每分钟最多20条
+	groupSendBurst = 3                // 群组允许的突发条数
+	idleBucketTTL  = 10 * time.Minute // 超过该时长未使用的聊天令牌桶会被清理
+)
+
+// tokenBucket 令牌桶, 令牌可以预支为负数, 预支后下一次可发送的时间相应推迟
+type tokenBucket struct {
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst}
+}
+
+func (b *tokenBucket) advance(now time.Time) {
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+}
+
+// delay 距离桶中有一个令牌还需要等待的时长
+func (b *tokenBucket) delay(now time.Time) time.Duration {
+	b.advance(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	b.tokens--
+}
+
+// drain 预支令牌, 保证 until 之前没有可用的令牌
+func (b *tokenBucket) drain(now, until time.Time) {
+	b.advance(now)
+	if tokens := 1 - until.Sub(now).Seconds()*b.rate; b.tokens > tokens {
+		b.tokens = tokens
+	}
+}
+
+// sendLimiter 按 Telegram 的全局、单个聊天和群组限制安排消息的发送时间
+type sendLimiter struct {
+	mu     sync.Mutex
+	global *tokenBucket
+	chats  map[int64]*tokenBucket
+	groups map[int64]*tokenBucket
+}
+
+func newSendLimiter() *sendLimiter {
+	return &sendLimiter{
+		global: newTokenBucket(globalSendRate, globalSendRate),
+		chats:  make(map[int64]*tokenBucket),
+		groups: make(map[int64]*tokenBucket),
+	}
+}
+
+// isGroupChat 群组和频道的 chatId 为负数
+func isGroupChat(chatId int64, msgType string) bool {
+	return chatId < 0 || msgType == "group" || msgType == "supergroup" || msgType == "channel"
+}
+
+// buckets 需要持有锁
+func (l *sendLimiter) buckets(chatId int64, msgType string) []*tokenBucket {
+	buckets := []*tokenBucket{l.global}
+	chat, ok := l.chats[chatId]
+	if !ok {
+		chat = newTokenBucket(chatSendRate, 1)
+		l.chats[chatId] = chat
+	}
+	buckets = append(buckets, chat)
+	if isGroupChat(chatId, msgType) {
+		group, ok := l.groups[chatId]
+		if !ok {
+			group = newTokenBucket(groupSendRate, groupSendBurst)
+			l.groups[chatId] = group
+		}
+		buckets = append(buckets, group)
+	}
+	return buckets
+}
+
+// reserve 预定一次发送, 返回可以发送的时间
+func (l *sendLimiter) reserve(chatId int64, msgType string, now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	buckets := l.buckets(chatId, msgType)
+	var wait time.Duration
+	for _, b := range buckets {
+		if d := b.delay(now); d > wait {
+			wait = d
+		}
+	}
+	for _, b := range buckets {
+		b.take()
+	}
+	return now.Add(wait)
+}
+
+// pause 收到 429 后暂停向该聊天发送, 之后的消息依次排在 until 之后
+func (l *sendLimiter) pause(chatId int64, msgType string, now, until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, b := range l.buckets(chatId, msgType)[1:] {
+		b.drain(now, until)
+	}
+}
+
+// cleanup 清理长时间未使用的聊天令牌桶
+func (l *sendLimiter) cleanup(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range []map[int64]*tokenBucket{l.chats, l.groups} {
+		for chatId, b := range m {
+			if now.Sub(b.last) > idleBucketTTL && b.delay(now) == 0 {
+				delete(m, chatId)
+			}
+		}
+	}
+}
+
+// retryAfter 解析 Telegram 429 错误中要求等待的时长
+func retryAfter(err error) (time.Duration, bool) {
+	var tgErr *tgbotapi.Error
+	if errors.As(err, &tgErr) && tgErr.RetryAfter > 0 {
+		return time.Duration(tgErr.RetryAfter) * time.Second, true
+	}
+	return 0, false
+}
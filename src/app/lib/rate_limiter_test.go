@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_sendLimiter(t *testing.T) {
+	l := newSendLimiter()
+	now := time.Now()
+
+	// 同一聊天每秒1条
+	assert.Equal(t, now, l.reserve(1, "", now))
+	assert.Equal(t, now.Add(time.Second), l.reserve(1, "", now))
+	assert.Equal(t, now.Add(2*time.Second), l.reserve(1, "", now))
+
+	// 群组允许少量突发, 之后每3秒1条
+	group := int64(-100)
+	assert.Equal(t, now, l.reserve(group, "group", now))
+	assert.Equal(t, now.Add(time.Second), l.reserve(group, "group", now))
+	assert.Equal(t, now.Add(2*time.Second), l.reserve(group, "group", now))
+	assert.Equal(t, now.Add(3*time.Second), l.reserve(group, "group", now))
+	assert.WithinDuration(t, now.Add(6*time.Second), l.reserve(group, "group", now), time.Millisecond)
+
+	// 全局每秒30条, 已经发送了8条
+	for i := int64(0); i < 22; i++ {
+		assert.Equal(t, now, l.reserve(1000+i, "", now))
+	}
+	assert.WithinDuration(t, now.Add(time.Second/30), l.reserve(2000, "", now), time.Millisecond)
+
+	// 429 后暂停该聊天
+	l.pause(3000, "", now, now.Add(5*time.Second))
+	assert.WithinDuration(t, now.Add(5*time.Second), l.reserve(3000, "", now), time.Millisecond)
+	assert.WithinDuration(t, now.Add(6*time.Second), l.reserve(3000, "", now), time.Millisecond)
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// recentItemsSize 每个 feed 保留的最近条目数量
+const recentItemsSize = 100
+
+var recentItems *RecentItems
+
+func init() {
+	recentItems = NewRecentItems(recentItemsSize)
+}
+
+func RecentItemsInstance() *RecentItems {
+	return recentItems
+}
+
+// RecentItems 按 feed 保存最近抓取到的条目, 供 /test 试运行关键字
+type RecentItems struct {
+	mu    sync.RWMutex
+	size  int
+	feeds map[string][]*gofeed.Item // 按抓取顺序, 最新的在前
+}
+
+func NewRecentItems(size int) *RecentItems {
+	return &RecentItems{
+		size:  size,
+		feeds: make(map[string][]*gofeed.Item),
+	}
+}
+
+func itemKey(item *gofeed.Item) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return item.Link
+}
+
+// Add 合并新抓取的条目, 按 guid/链接去重并保留最近 size 条
+func (r *RecentItems) Add(feedId string, items []*gofeed.Item) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	merged := make([]*gofeed.Item, 0, r.size)
+	seen := make(map[string]struct{})
+	for _, list := range [][]*gofeed.Item{items, r.feeds[feedId]} {
+		for _, item := range list {
+			if item == nil || len(merged) >= r.size {
+				continue
+			}
+			key := itemKey(item)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			merged = append(merged, item)
+		}
+	}
+	r.feeds[feedId] = merged
+}
+
+// List 返回 feed 最近的条目
+func (r *RecentItems) List(feedId string) []*gofeed.Item {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	items := make([]*gofeed.Item, len(r.feeds[feedId]))
+	copy(items, r.feeds[feedId])
+	return items
+}
+
+// Remove 删除 feed 的全部条目
+func (r *RecentItems) Remove(feedId string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.feeds, feedId)
+}
+
+// TestKeyword 使用最近抓取的条目试运行关键字, 返回会被匹配的条目, 不写入通知历史
+func TestKeyword(feedId string, keyword string) ([]*gofeed.Item, int, error) {
+	if err := validateKeywords([]string{keyword}); err != nil {
+		return nil, 0, err
+	}
+	rule, err := compileKeyword(keyword)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := RecentItemsInstance().List(feedId)
+	var matched []*gofeed.Item
+	for _, item := range items {
+		if rule.match(newMatchDoc(item)) {
+			matched = append(matched, item)
+		}
+	}
+	return matched, len(items), nil
+}
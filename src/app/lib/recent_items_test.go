@@ -0,0 +1,43 @@
+package lib
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentItems_Add(t *testing.T) {
+	r := NewRecentItems(3)
+	r.Add("ns", []*gofeed.Item{{GUID: "1"}, {GUID: "2"}})
+	r.Add("ns", []*gofeed.Item{{GUID: "3"}, {GUID: "2"}, {Link: "https://x/4"}})
+
+	var keys []string
+	for _, item := range r.List("ns") {
+		keys = append(keys, itemKey(item))
+	}
+	assert.Equal(t, []string{"3", "2", "https://x/4"}, keys)
+	assert.Empty(t, r.List("other"))
+
+	r.Remove("ns")
+	assert.Empty(t, r.List("ns"))
+}
+
+func TestTestKeyword(t *testing.T) {
+	feedId := "test_keyword"
+	var items []*gofeed.Item
+	for i := 0; i < 5; i++ {
+		items = append(items, &gofeed.Item{GUID: fmt.Sprint(i), Title: fmt.Sprintf("出港仔 %d", i)})
+	}
+	items = append(items, &gofeed.Item{GUID: "收", Title: "收港仔"})
+	RecentItemsInstance().Add(feedId, items)
+
+	matched, total, err := TestKeyword(feedId, "港仔 NOT 收")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, total)
+	assert.Len(t, matched, 5)
+
+	_, _, err = TestKeyword(feedId, "港仔 AND (")
+	assert.Error(t, err)
+}
@@ -0,0 +1,121 @@
+package lib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// regexMatchTimeout 单次正则匹配的超时时间
+	regexMatchTimeout = 100 * time.Millisecond
+	// maxRegexTimeouts 正则累计超时次数达到该值后自动停用
+	maxRegexTimeouts int32 = 3
+)
+
+const (
+	maxRegexLength     = 256  // 正则最大长度(字符)
+	maxRegexLookaround = 6    // 最多允许的环视数量
+	maxRegexRepeat     = 1000 // {n,m} 允许的最大重复次数
+)
+
+// checkRegexComplexity 在添加关键字时检查正则复杂度, 拒绝容易导致灾难性回溯的写法
+func checkRegexComplexity(keyword, pattern string) error {
+	runes := []rune(pattern)
+	if len(runes) > maxRegexLength {
+		return fmt.Errorf("关键字 %s 太长, 正则最多 %d 个字符", keyword, maxRegexLength)
+	}
+
+	// 每层分组记录内部是否包含无上限的量词
+	stack := []bool{false}
+	lookarounds := 0
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\\':
+			i++
+		case '[':
+			// 跳过字符集
+			for i++; i < len(runes) && runes[i] != ']'; i++ {
+				if runes[i] == '\\' {
+					i++
+				}
+			}
+		case '(':
+			rest := string(runes[i+1:])
+			if strings.HasPrefix(rest, "?=") || strings.HasPrefix(rest, "?!") ||
+				strings.HasPrefix(rest, "?<=") || strings.HasPrefix(rest, "?<!") {
+				lookarounds++
+				if lookarounds > maxRegexLookaround {
+					return fmt.Errorf("关键字 %s 的环视过多, 最多 %d 个", keyword, maxRegexLookaround)
+				}
+			}
+			stack = append(stack, false)
+		case ')':
+			if len(stack) == 1 {
+				continue
+			}
+			inner := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			unbounded, err := quantifierAt(runes, i+1)
+			if err != nil {
+				return fmt.Errorf("关键字 %s 第%d个字符处%s", keyword, i+2, err)
+			}
+			if inner && unbounded {
+				return fmt.Errorf("关键字 %s 第%d个字符处存在嵌套的重复量词, 容易导致匹配超时", keyword, i+2)
+			}
+			if inner || unbounded {
+				stack[len(stack)-1] = true
+			}
+		case '*', '+':
+			stack[len(stack)-1] = true
+		case '{':
+			unbounded, err := quantifierAt(runes, i)
+			if err != nil {
+				return fmt.Errorf("关键字 %s 第%d个字符处%s", keyword, i+1, err)
+			}
+			if unbounded {
+				stack[len(stack)-1] = true
+			}
+		}
+	}
+	return nil
+}
+
+// quantifierAt 判断 runes[i] 处的量词是否无上限
+func quantifierAt(runes []rune, i int) (bool, error) {
+	if i >= len(runes) {
+		return false, nil
+	}
+	switch runes[i] {
+	case '*', '+':
+		return true, nil
+	case '{':
+		end := i + 1
+		for end < len(runes) && runes[end] != '}' {
+			end++
+		}
+		if end >= len(runes) {
+			return false, nil
+		}
+		parts := strings.Split(string(runes[i+1:end]), ",")
+		if len(parts) > 2 {
+			return false, nil
+		}
+		for _, p := range parts {
+			if p == "" {
+				continue
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				// 不是量词, 按普通字符处理
+				return false, nil
+			}
+			if n > maxRegexRepeat {
+				return false, fmt.Errorf("的重复次数 %d 超过上限 %d", n, maxRegexRepeat)
+			}
+		}
+		return len(parts) == 2 && parts[1] == "", nil
+	}
+	return false, nil
+}
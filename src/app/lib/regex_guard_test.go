@@ -0,0 +1,107 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkRegexComplexity(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{name: "环视", pattern: `(?=.*(港仔|boil))(?=.*出)`, wantErr: false},
+		{name: "普通分组量词", pattern: `(ab)+c*`, wantErr: false},
+		{name: "有上限的嵌套", pattern: `(a+){2}`, wantErr: false},
+		{name: "字符集中的括号", pattern: `[(+]+`, wantErr: false},
+		{name: "嵌套量词", pattern: `(a+)+$`, wantErr: true},
+		{name: "深层嵌套量词", pattern: `((a*)b)*`, wantErr: true},
+		{name: "嵌套无上限重复", pattern: `(.*a){1,}`, wantErr: true},
+		{name: "重复次数过大", pattern: `a{1,5000}`, wantErr: true},
+		{name: "环视过多", pattern: strings.Repeat(`(?=.*a)`, 7), wantErr: true},
+		{name: "正则过长", pattern: strings.Repeat("a", 300), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRegexComplexity(tt.pattern, tt.pattern)
+			assert.Equal(t, tt.wantErr, err != nil, "err = %v", err)
+		})
+	}
+}
+
+func Test_keywordRuleTimeout(t *testing.T) {
+	oldTimeout, oldHandler := regexMatchTimeout, onRuleDisabled
+	defer func() {
+		regexMatchTimeout, onRuleDisabled = oldTimeout, oldHandler
+	}()
+	regexMatchTimeout = 5 * time.Millisecond
+
+	disabled := make(chan string, 1)
+	onRuleDisabled = func(chatId int64, feedId string, keyword string) {
+		disabled <- keyword
+	}
+
+	// 灾难性回溯的正则, 编译时不做复杂度检查, 模拟历史数据
+	keyword := `^(\w+\s?)*$`
+	rule, err := compileKeyword(keyword)
+	assert.NoError(t, err)
+	rule.chatId, rule.feedId = 1, "ns"
+
+	doc := newTitleDoc(strings.Repeat("aaaa ", 20) + "!")
+	for i := int32(0); i < maxRegexTimeouts; i++ {
+		assert.False(t, rule.match(doc))
+	}
+
+	select {
+	case v := <-disabled:
+		assert.Equal(t, keyword, v)
+	case <-time.After(time.Second):
+		t.Fatal("rule not disabled")
+	}
+	assert.True(t, rule.disabled.Load())
+}
+
+func Test_keywordRuleTimeoutWithoutOwner(t *testing.T) {
+	oldTimeout, oldHandler, oldWebhookHandler := regexMatchTimeout, onRuleDisabled, onWebhookRuleDisabled
+	defer func() {
+		regexMatchTimeout, onRuleDisabled, onWebhookRuleDisabled = oldTimeout, oldHandler, oldWebhookHandler
+	}()
+	regexMatchTimeout = 5 * time.Millisecond
+	onRuleDisabled = func(int64, string, string) { t.Error("rule without owner should not notify subscribers") }
+
+	disabled := make(chan uint, 1)
+	onWebhookRuleDisabled = func(webhookId uint, keyword string) {
+		disabled <- webhookId
+	}
+
+	keyword := `^(\w+\s?)*$`
+	doc := newTitleDoc(strings.Repeat("aaaa ", 20) + "!")
+
+	// 共享缓存中的规则没有所属者, 多次超时也不会停用
+	rule, err := getCachedRule(keyword)
+	assert.NoError(t, err)
+	for i := int32(0); i < maxRegexTimeouts+1; i++ {
+		_, ok := matchKeywords(doc, []string{keyword})
+		assert.False(t, ok)
+	}
+	assert.False(t, rule.disabled.Load())
+	assert.Equal(t, int32(0), rule.timeouts.Load())
+
+	// webhook 的规则停用后停用所属的 webhook
+	m := newWebhookMatcher(&db.Webhook{ID: 9, FeedId: "ns", KeywordsArray: []string{keyword}})
+	for i := int32(0); i < maxRegexTimeouts; i++ {
+		assert.False(t, m.matcher.match(doc))
+	}
+	select {
+	case v := <-disabled:
+		assert.Equal(t, uint(9), v)
+	case <-time.After(time.Second):
+		t.Fatal("webhook not disabled")
+	}
+}
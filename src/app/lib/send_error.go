@@ -0,0 +1,112 @@
+package lib
+
+import (
+	"errors"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// sendErrorKind 发送失败的类型, 决定是否重试
+type sendErrorKind int
+
+const (
+	sendRetryable   sendErrorKind = iota // 网络错误、Telegram 服务端错误等, 稍后重试
+	sendPermanent                        // 消息本身有问题, 重试也无法成功
+	sendUnreachable                      // 聊天无法送达, 例如用户屏蔽了机器人、聊天不存在
+)
+
+func (k sendErrorKind) String() string {
+	switch k {
+	case sendRetryable:
+		return "retryable"
+	case sendPermanent:
+		return "permanent"
+	case sendUnreachable:
+		return "unreachable"
+	}
+	return "unknown"
+}
+
+const (
+	maxSendAttempts  = 6                // 最多发送次数, 超过后写入死信表
+	baseRetryBackoff = 10 * time.Second // 第一次重试的等待时长, 之后每次翻倍
+	maxRetryBackoff  = 30 * time.Minute
+)
+
+// unreachableErrors Telegram 返回的聊天无法送达的错误信息
+var unreachableErrors = []string{
+	"bot was blocked by the user",
+	"bot was kicked",
+	"user is deactivated",
+	"chat not found",
+	"peer_id_invalid",
+	"have no rights to send",
+	"not enough rights to send",
+	"group chat was upgraded",
+	"bot is not a member",
+	"chat was deleted",
+}
+
+// classifySendError 判断发送失败的类型
+func classifySendError(err error) sendErrorKind {
+	if kind, ok := classifyTargetError(err); ok {
+		return kind
+	}
+	var tgErr *tgbotapi.Error
+	if !errors.As(err, &tgErr) {
+		return sendRetryable
+	}
+	msg := strings.ToLower(tgErr.Message)
+	for _, s := range unreachableErrors {
+		if strings.Contains(msg, s) {
+			return sendUnreachable
+		}
+	}
+	switch tgErr.Code {
+	case http.StatusForbidden:
+		return sendUnreachable
+	case http.StatusBadRequest:
+		return sendPermanent
+	}
+	return sendRetryable
+}
+
+// retryBackoff 第 attempts 次发送失败后的重试间隔
+func retryBackoff(attempts int) time.Duration {
+	backoff := baseRetryBackoff
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+// classifyTargetError 判断其它推送目标发送失败的类型, 不会返回 sendUnreachable
+func classifyTargetError(err error) (sendErrorKind, bool) {
+	if errors.Is(err, errTargetUnavailable) || errors.Is(err, errPrivateTarget) {
+		return sendPermanent, true
+	}
+	var statusErr *notifyStatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.Status == http.StatusTooManyRequests, statusErr.Status == http.StatusRequestTimeout, statusErr.Status >= 500:
+			return sendRetryable, true
+		}
+		return sendPermanent, true
+	}
+	// SMTP 5xx 为永久错误, 4xx 为临时错误
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		if smtpErr.Code >= 500 {
+			return sendPermanent, true
+		}
+		return sendRetryable, true
+	}
+	return sendRetryable, false
+}
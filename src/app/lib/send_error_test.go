@@ -0,0 +1,38 @@
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_classifySendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want sendErrorKind
+	}{
+		{"network", errors.New("dial tcp: i/o timeout"), sendRetryable},
+		{"server error", &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, sendRetryable},
+		{"too many requests", &tgbotapi.Error{Code: 429, Message: "Too Many Requests: retry after 5"}, sendRetryable},
+		{"blocked", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}, sendUnreachable},
+		{"kicked", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was kicked from the group chat"}, sendUnreachable},
+		{"chat not found", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, sendUnreachable},
+		{"parse entities", &tgbotapi.Error{Code: 400, Message: "Bad Request: can't parse entities"}, sendPermanent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, classifySendError(tt.err))
+		})
+	}
+}
+
+func Test_retryBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, retryBackoff(1))
+	assert.Equal(t, 20*time.Second, retryBackoff(2))
+	assert.Equal(t, 80*time.Second, retryBackoff(4))
+	assert.Equal(t, maxRetryBackoff, retryBackoff(20))
+}
@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"strings"
+
+	"ns-rss/src/app/db"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// unreachableStatus 根据发送失败的原因判断订阅者的状态, 私聊为 blocked, 群组和频道为 kicked
+func unreachableStatus(chatId int64, reason string) string {
+	reason = strings.ToLower(reason)
+	switch {
+	case strings.Contains(reason, "blocked") || strings.Contains(reason, "user is deactivated"):
+		return db.SubscribeStatusBlocked
+	case strings.Contains(reason, "kicked") || strings.Contains(reason, "not a member"):
+		return db.SubscribeStatusKicked
+	case chatId < 0:
+		return db.SubscribeStatusKicked
+	}
+	return db.SubscribeStatusBlocked
+}
+
+// isActiveStatus 是否开启了通知
+func isActiveStatus(status string) bool {
+	return status == "on" || status == ""
+}
+
+// deactivateSubscriber 将开启通知的订阅者标记为 blocked 或 kicked, 不再向其发送消息
+func deactivateSubscriber(chatId int64, status string, reason string) {
+	sub := db.GetSubscribeWithChatId(chatId)
+	if sub == nil || !isActiveStatus(sub.Status) {
+		return
+	}
+	if err := db.UpdateSubscribeStatus(chatId, status); err != nil {
+		logx.Errorw("deactivate subscriber failed", logx.Field("err", err), logx.Field("chatId", chatId))
+		return
+	}
+	SubCacheInstance().Del(chatId)
+	SubCacheInstance().ReloadAll()
+	logx.Infow("subscriber deactivated", logx.Field("chatId", chatId), logx.Field("status", status), logx.Field("reason", reason))
+}
+
+// deactivateUnreachableSubscriber 消息无法送达时停用订阅者
+func deactivateUnreachableSubscriber(chatId int64, err error) {
+	deactivateSubscriber(chatId, unreachableStatus(chatId, err.Error()), err.Error())
+}
+
+// reactivateSubscriber 被停用的订阅者再次与机器人交互时恢复通知
+func reactivateSubscriber(sub *db.Subscribe) {
+	if sub.Status != db.SubscribeStatusBlocked && sub.Status != db.SubscribeStatusKicked {
+		return
+	}
+	if err := db.UpdateSubscribeStatus(sub.ChatId, "on"); err != nil {
+		logx.Errorw("reactivate subscriber failed", logx.Field("err", err), logx.Field("chatId", sub.ChatId))
+		return
+	}
+	logx.Infow("subscriber reactivated", logx.Field("chatId", sub.ChatId), logx.Field("status", sub.Status))
+	sub.Status = "on"
+	SubCacheInstance().Del(sub.ChatId)
+	SubCacheInstance().ReloadAll()
+}
+
+// handleMyChatMember 处理机器人在聊天中的成员状态变化
+// 私聊中用户屏蔽机器人时状态为 kicked, 解除屏蔽后为 member
+func handleMyChatMember(update *tgbotapi.ChatMemberUpdated) {
+	chatId := update.Chat.ID
+	switch update.NewChatMember.Status {
+	case "kicked", "left":
+		status := db.SubscribeStatusKicked
+		if update.Chat.IsPrivate() {
+			status = db.SubscribeStatusBlocked
+		}
+		deactivateSubscriber(chatId, status, "my_chat_member: "+update.NewChatMember.Status)
+	case "member", "administrator", "creator":
+		if sub := db.GetSubscribeWithChatId(chatId); sub != nil {
+			reactivateSubscriber(sub)
+		}
+	}
+}
+
+// subscriberCounts 按状态统计订阅者数量, 空状态计为 on
+func subscriberCounts(subs []*db.Subscribe) map[string]int {
+	counts := make(map[string]int)
+	for _, sub := range subs {
+		status := sub.Status
+		if status == "" {
+			status = "on"
+		}
+		counts[status]++
+	}
+	return counts
+}
@@ -0,0 +1,30 @@
+package lib
+
+import (
+	"testing"
+
+	"ns-rss/src/app/db"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_unreachableStatus(t *testing.T) {
+	assert.Equal(t, db.SubscribeStatusBlocked, unreachableStatus(1, "Forbidden: bot was blocked by the user"))
+	assert.Equal(t, db.SubscribeStatusBlocked, unreachableStatus(1, "Forbidden: user is deactivated"))
+	assert.Equal(t, db.SubscribeStatusKicked, unreachableStatus(-100, "Forbidden: bot was kicked from the supergroup chat"))
+	assert.Equal(t, db.SubscribeStatusKicked, unreachableStatus(-100, "Forbidden: bot is not a member of the channel chat"))
+	assert.Equal(t, db.SubscribeStatusKicked, unreachableStatus(-100, "Bad Request: chat not found"))
+	assert.Equal(t, db.SubscribeStatusBlocked, unreachableStatus(1, "Bad Request: chat not found"))
+}
+
+func Test_subscriberCounts(t *testing.T) {
+	counts := subscriberCounts([]*db.Subscribe{
+		{Status: "on"},
+		{Status: ""},
+		{Status: "off"},
+		{Status: db.SubscribeStatusBlocked},
+		{Status: db.SubscribeStatusKicked},
+		{Status: db.SubscribeStatusKicked},
+	})
+	assert.Equal(t, map[string]int{"on": 2, "off": 1, "blocked": 1, "kicked": 2}, counts)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,17 +17,25 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/thoas/go-funk"
 	"github.com/zeromicro/go-zero/core/rescue"
+	"github.com/zeromicro/go-zero/core/threading"
 
 	"ns-rss/src/app/config"
 	"ns-rss/src/app/db"
+	"ns-rss/src/app/msgfmt"
 	"ns-rss/src/app/vars"
 )
 
 const (
-	cmdFeed   = "/feed" //查看当前支持的RSS源
-	cmdHelp   = "/help"
-	cmdStatus = "/status"
-	cmdAdd    = "/add"
+	cmdFeed     = "/feed" //查看当前支持的RSS源
+	cmdHelp     = "/help"
+	cmdStatus   = "/status"
+	cmdAdd      = "/add"
+	cmdTest     = "/test"
+	cmdMode     = "/mode"
+	cmdTz       = "/tz"
+	cmdQuiet    = "/quiet"
+	cmdTarget   = "/target"
+	cmdTemplate = "/template"
 )
 
 var helpText = `
@@ -37,12 +46,31 @@ var helpText = `
 
 /add feedId 关键字1 关键字2 关键字3.... 增加新的关键字
 
-任何使用上的帮助或建议可以联系大管家 @hello\_cello\_bot
+添加时加上 --backfill 6h 可回溯最近的帖子(最多24h), 例如: /add ns --backfill 6h 港仔
+
+关键字支持 AND OR NOT 组合, 例如: /add ns iPhone AND 频道 NOT 收
+
+关键字默认匹配标题, 可用 desc: author: cat: 匹配正文、作者、分类, 例如: /add ns desc:年付
+
+/test feedId 关键字 用最近的帖子试运行关键字, 不会发送通知
+
+/mode 设置推送方式: 实时推送、每小时汇总或每天定时汇总, 例如: /mode daily 21:30
+
+/tz 设置时区, 推送中的时间和摘要、免打扰时间按该时区计算, 例如: /tz Asia/Tokyo 或 /tz UTC+8
+
+/target 同时推送到 webhook、Discord、Slack、邮件、ntfy、Gotify、Bark, 例如: /target add ntfy https://ntfy.sh/your_topic, 发送 /target 查看更多用法
+
+/template 自定义推送消息的模板, 例如: /template set *{{.Title}}* {{.Link}}, 发送 /template 查看可用的变量
+
+/quiet 设置免打扰时段, hold 暂存到结束后汇总推送(默认), silent 照常推送但不提醒, 例如: /quiet 23:00-08:00 silent, 关闭: /quiet off
+
+任何使用上的帮助或建议可以联系大管家 @hello_cello_bot
 `
 
 var (
 	tgBot          *tgbotapi.BotAPI
 	mainMenu       tgbotapi.InlineKeyboardMarkup
+	mainMenuMu     sync.RWMutex
 	lastMessageIDs sync.Map // 存储每个chat的最后一条消息ID
 )
 
@@ -59,9 +87,15 @@ type CommandHandler func(*db.Subscribe, []string) (*tgbotapi.MessageConfig, erro
 
 // 命令处理器映射
 var commandHandlers = map[string]CommandHandler{
-	cmdFeed: handleFeed,
-	cmdAdd:  handleAdd,
-	cmdHelp: handleHelp,
+	cmdFeed:     handleFeed,
+	cmdAdd:      handleAdd,
+	cmdTest:     handleTest,
+	cmdHelp:     handleHelp,
+	cmdMode:     handleMode,
+	cmdTz:       handleTz,
+	cmdQuiet:    handleQuiet,
+	cmdTarget:   handleTarget,
+	cmdTemplate: handleTemplate,
 }
 
 func InitTgBotListen(cnf *config.Config) {
@@ -89,10 +123,27 @@ func updates(cfg *config.Config) {
 	u.Timeout = 60
 	updates := tgBot.GetUpdatesChan(u)
 
+	// feed 列表变更时重建菜单
+	registry := FeedRegistryInstance()
+	registry.Subscribe(func(FeedEvent, db.FeedConfig) {
+		rebuildMainMenu(cfg.AdminId)
+	})
+	registry.Reload()
+	rebuildMainMenu(cfg.AdminId)
+
+	for update := range updates {
+		processMessage(cfg, update)
+	}
+}
+
+// rebuildMainMenu 根据当前的 feed 列表重建主菜单
+func rebuildMainMenu(adminId int64) {
 	var buttons []tgbotapi.InlineKeyboardButton
 
-	feeds := db.ListAllFeedConfig()
-	for _, v := range feeds {
+	for _, v := range FeedRegistryInstance().List() {
+		if v.Paused {
+			continue
+		}
 		event := &vars.CallbackEvent[vars.CallbackFeedData]{
 			Data: vars.CallbackFeedData{
 				FeedId: v.FeedId,
@@ -102,27 +153,33 @@ func updates(cfg *config.Config) {
 	}
 
 	// 为管理员添加统计按钮
-	if cfg.AdminId != 0 {
+	if adminId != 0 {
 		statusEvent := &vars.CallbackEvent[vars.CallbackStatus]{
 			Data: vars.CallbackStatus{
-				ChatId: cfg.AdminId,
+				ChatId: adminId,
 			},
 		}
 		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData("📊 统计", statusEvent.Param()))
 	}
 
-	mainMenu = tgbotapi.NewInlineKeyboardMarkup()
+	menu := tgbotapi.NewInlineKeyboardMarkup()
 
 	chunkButton := funk.Chunk(buttons, 2).([][]tgbotapi.InlineKeyboardButton)
 	for _, keyboardButtons := range chunkButton {
 		row := make([]tgbotapi.InlineKeyboardButton, 0, len(keyboardButtons))
 		row = append(row, keyboardButtons...)
-		mainMenu.InlineKeyboard = append(mainMenu.InlineKeyboard, row)
+		menu.InlineKeyboard = append(menu.InlineKeyboard, row)
 	}
 
-	for update := range updates {
-		processMessage(cfg, update)
-	}
+	mainMenuMu.Lock()
+	mainMenu = menu
+	mainMenuMu.Unlock()
+}
+
+func getMainMenu() tgbotapi.InlineKeyboardMarkup {
+	mainMenuMu.RLock()
+	defer mainMenuMu.RUnlock()
+	return mainMenu
 }
 
 // extractChatInfo 从更新中提取聊天信息
@@ -164,6 +221,11 @@ func extractChatInfo(update tgbotapi.Update) *ChatInfo {
 func processMessage(cfg *config.Config, update tgbotapi.Update) {
 	defer rescue.Recover()
 
+	if update.MyChatMember != nil {
+		handleMyChatMember(update.MyChatMember)
+		return
+	}
+
 	chatInfo := extractChatInfo(update)
 	if chatInfo == nil || chatInfo.Text == "" {
 		return
@@ -177,6 +239,7 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 	if subscriber == nil || subscriber.Status == "quit" {
 		return
 	}
+	reactivateSubscriber(subscriber)
 
 	// 处理回调数据
 	if update.CallbackQuery != nil {
@@ -224,7 +287,11 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 					if len(data.Param()) > 64 {
 						continue
 					}
-					keywords = append(keywords, tgbotapi.NewInlineKeyboardButtonData("🗑️ "+v, data.Param()))
+					text := "🗑️ " + v
+					if subscribe.IsKeywordDisabled(v) {
+						text = "⛔ " + v
+					}
+					keywords = append(keywords, tgbotapi.NewInlineKeyboardButtonData(text, data.Param()))
 				}
 				keyboard := tgbotapi.NewInlineKeyboardMarkup()
 
@@ -249,9 +316,8 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 				)
 				keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(backToMain))
 
-				msg := tgbotapi.NewMessage(chatID, "以下是您已添加的 "+feed.Name+" 关键字:")
+				msg := newFormattedMessage(chatID, msgfmt.Text("以下是您已添加的 "+feed.Name+" 关键字:"))
 				msg.ReplyMarkup = keyboard
-				msg.ParseMode = tgbotapi.ModeHTML
 				sendMessage(&msg)
 			} else {
 				// 创建添加关键字的事件
@@ -342,7 +408,8 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 			text := fmt.Sprintf("请输入想要添加的关键字，格式如下：\n"+
 				"/add %s 关键字1 正则表达式 ...\n\n"+
 				"示例：\n"+
-				"/add %s 科技 ", feed.FeedId, feed.FeedId)
+				"/add %s 科技 \n"+
+				"/add %s iPhone AND 频道 NOT 收", feed.FeedId, feed.FeedId, feed.FeedId)
 
 			msg := tgbotapi.NewMessage(chatID, text)
 			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
@@ -355,7 +422,7 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 
 		case string(vars.EventBackToMain):
 			msg := tgbotapi.NewMessage(chatID, "请选择Feed源:")
-			msg.ReplyMarkup = mainMenu
+			msg.ReplyMarkup = getMainMenu()
 			sendMessage(&msg)
 			return
 		case string(vars.EventOn):
@@ -366,6 +433,20 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 			msg, _ := handleOff(subscriber, nil)
 			sendMessage(msg)
 			return
+		case string(vars.EventMode):
+			var modeEvent vars.CallbackEvent[vars.CallbackMode]
+			if err := json.Unmarshal([]byte(callbackData), &modeEvent); err != nil {
+				return
+			}
+			msg, err := handleMode(subscriber, []string{modeEvent.Data.Mode})
+			SubCacheInstance().Del(subscriber.ChatId)
+			if err != nil {
+				errMsg := tgbotapi.NewMessage(chatID, err.Error())
+				sendMessage(&errMsg)
+				return
+			}
+			sendMessage(msg)
+			return
 		case string(vars.EventStatus):
 			var statusEvent vars.CallbackEvent[vars.CallbackStatus]
 			if err := json.Unmarshal([]byte(callbackData), &statusEvent); err != nil {
@@ -390,28 +471,31 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 				ip = "未知"
 			}
 
-			// 计算活跃用户数（status为"on"的用户）
-			var activeUsers int
-			for _, sub := range subscribers {
-				if sub.Status == "on" || sub.Status == "" {
-					activeUsers++
-				}
-			}
+			// 按状态统计用户数（status为空视为"on"）
+			counts := subscriberCounts(subscribers)
 
 			// 获取所有Feed的统计信息
-
 			message := fmt.Sprintf("📊 系统统计\n"+
 				"-------------------\n"+
 				"👥 总用户数: %d\n"+
 				"✅ 活跃用户: %d\n"+
+				"🚫 屏蔽机器人: %d\n"+
+				"👋 移出群组/频道: %d\n"+
 				"📨 今日推送: %d\n"+
+				"📬 待发送: %d\n"+
 				"🌐 当前IP: %s\n"+
 				"-------------------\n",
 				len(subscribers),
-				activeUsers,
+				counts["on"],
+				counts[db.SubscribeStatusBlocked],
+				counts[db.SubscribeStatusKicked],
 				todaySend,
+				db.CountPendingOutbox(),
 				ip,
 			)
+			if health := feedHealthText(); health != "" {
+				message += "📡 RSS源状态\n" + health + "\n"
+			}
 
 			// 创建刷新按钮
 			refreshEvent := vars.CallbackEvent[vars.CallbackStatus]{
@@ -436,7 +520,6 @@ func processMessage(cfg *config.Config, update tgbotapi.Update) {
 
 			msg := tgbotapi.NewMessage(chatID, message)
 			msg.ReplyMarkup = keyboard
-			msg.ParseMode = tgbotapi.ModeHTML
 			sendMessage(&msg)
 			return
 		}
@@ -513,14 +596,22 @@ func splitAndClean(text string) []string {
 	})
 }
 
-// sendMessage 发送消息
+// newFormattedMessage 使用 msgfmt 构造的消息, 以 HTML 格式发送
+func newFormattedMessage(chatId int64, text msgfmt.Message) tgbotapi.MessageConfig {
+	msg := tgbotapi.NewMessage(chatId, text.HTML())
+	msg.ParseMode = tgbotapi.ModeHTML
+	return msg
+}
+
+// sendMessage 发送消息, 未指定格式的消息按纯文本转义后发送
 func sendMessage(msg *tgbotapi.MessageConfig) {
 	if msg.ParseMode == "" {
-		msg.ParseMode = tgbotapi.ModeMarkdown
-		// 如果使用Markdown模式，自动转义特殊字符
-		msg.Text = escapeMarkdown(msg.Text)
+		msg.Text = msgfmt.Text(msg.Text).HTML()
+		msg.ParseMode = tgbotapi.ModeHTML
 	}
+	start := time.Now()
 	result, err := tgBot.Send(msg)
+	observeTelegram("sendMessage", start, err)
 	if err != nil {
 		log.WithField("msg", msg.Text).
 			WithError(err).
@@ -559,7 +650,7 @@ func sendMessage(msg *tgbotapi.MessageConfig) {
 func handleFeed(sub *db.Subscribe, _ []string) (*tgbotapi.MessageConfig, error) {
 
 	msg := tgbotapi.NewMessage(sub.ChatId, "当前支持的feed源, 请点击选择:")
-	msg.ReplyMarkup = mainMenu
+	msg.ReplyMarkup = getMainMenu()
 	return &msg, nil
 }
 
@@ -575,13 +666,34 @@ func handleAdd(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error
 	if v.ID == 0 {
 		return nil, errors.New("未找到该feed")
 	}
+	if v.Paused {
+		return nil, errors.New("该feed已暂停, 暂时无法添加关键字")
+	}
 
-	args = args[1:]
+	args, backfill, err := parseBackfillFlag(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("请输入你要添加的关键字, 例如: /add feedId keyword")
+	}
+
+	args = splitRules(strings.Join(args, " "))
 
 	args = funk.Map(args, func(s string) string {
-		return strings.Trim(strings.TrimSpace(s), "{}")
+		s = strings.TrimSpace(s)
+		// 兼容旧的 {a|b} 写法
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			s = strings.TrimSuffix(strings.TrimPrefix(s, "{"), "}")
+		}
+		return s
 	}).([]string)
 
+	// 检查关键字语法
+	if err := validateKeywords(args); err != nil {
+		return nil, err
+	}
+
 	// 检查每个关键字的callback_data长度
 	var invalidKeywords []string
 	for _, keyword := range args {
@@ -600,22 +712,49 @@ func handleAdd(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error
 		return nil, fmt.Errorf("以下关键字太长，请缩短后重新添加：\n%s", strings.Join(invalidKeywords, "\n"))
 	}
 
+	newKeywords := args
+
 	//更新db
 	exists := db.ListSubscribeFeedWith(sub.ChatId, feedId)
 	if exists.ID > 0 {
+		// 升级前保存的关键字尚未检查时先检查, 之后添加的关键字都按新语法匹配
+		if !exists.KeywordsChecked {
+			exists.LegacyKeywordsArray = checkStoredKeywords(exists)
+			exists.KeywordsChecked = true
+		}
+		// 重新添加的关键字已通过校验, 解除停用并按新语法匹配
+		exists.DisabledKeywordsArray = funk.SubtractString(exists.DisabledKeywordsArray, args)
+		exists.LegacyKeywordsArray = funk.SubtractString(exists.LegacyKeywordsArray, args)
 		//取一下并集
 		args = append(args, exists.KeywordsArray...)
 		args = funk.UniqString(args)
 		exists.KeywordsArray = args
 	} else {
 		exists = db.SubscribeConfig{
-			ChatId:        sub.ChatId,
-			KeywordsArray: args,
-			FeedId:        feedId,
+			ChatId:          sub.ChatId,
+			KeywordsArray:   args,
+			FeedId:          feedId,
+			KeywordsChecked: true,
 		}
 	}
 	db.AddSubscribeConfig(exists)
-	msg := tgbotapi.NewMessage(sub.ChatId, "🎉关键字添加成功")
+	MatcherRegistryInstance().Reload(sub.ChatId, feedId)
+	text := "🎉关键字添加成功"
+	if backfill > 0 {
+		if feeder := NsFeedInstance(); feeder != nil {
+			// 回溯要逐条匹配最近的帖子, 可能较慢, 在后台进行, 避免阻塞其他用户的命令
+			chatId := sub.ChatId
+			threading.GoSafe(func() {
+				count := feeder.Backfill(chatId, v, newKeywords, backfill)
+				msg := tgbotapi.NewMessage(chatId, fmt.Sprintf("已回溯最近 %v 的帖子, 新命中 %d 条", backfill, count))
+				sendMessage(&msg)
+			})
+			text += fmt.Sprintf(", 正在回溯最近 %v 的帖子, 完成后通知", backfill)
+		} else {
+			text += ", 当前未开启抓取, 无法回溯"
+		}
+	}
+	msg := tgbotapi.NewMessage(sub.ChatId, text)
 	// 获取关键字列表
 
 	if len(exists.KeywordsArray) > 0 {
@@ -658,6 +797,61 @@ func handleAdd(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error
 	return &msg, nil
 }
 
+// testResultLimit /test 最多展示的匹配条数
+const testResultLimit = 20
+
+func handleTest(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error) {
+	if len(args) < 2 {
+		return nil, errors.New("请输入你要测试的关键字, 例如: /test feedId keyword")
+	}
+
+	feedId := args[0]
+	v := db.GetFeedConfigWithFeedId(feedId)
+	if v.ID == 0 {
+		return nil, errors.New("未找到该feed")
+	}
+
+	keyword := strings.Join(args[1:], " ")
+	// 正则要逐条匹配最近的帖子, 可能较慢, 在后台测试, 避免阻塞其他用户的命令
+	chatId := sub.ChatId
+	threading.GoSafe(func() {
+		msg, err := testKeywordMessage(chatId, v, keyword)
+		if err != nil {
+			errMsg := tgbotapi.NewMessage(chatId, err.Error())
+			msg = &errMsg
+		}
+		sendMessage(msg)
+	})
+	return nil, nil
+}
+
+// testKeywordMessage 用 feed 最近的帖子测试关键字, 生成 /test 的结果
+func testKeywordMessage(chatId int64, v db.FeedConfig, keyword string) (*tgbotapi.MessageConfig, error) {
+	matched, total, err := TestKeyword(v.FeedId, keyword)
+	if err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, errors.New("暂无该feed的最近帖子, 请稍后再试")
+	}
+
+	text := msgfmt.New(
+		msgfmt.Plain("关键字 "), msgfmt.Code(keyword),
+		msgfmt.Plain(fmt.Sprintf(" 在 %s 最近 %d 条帖子中匹配 %d 条", v.Name, total, len(matched))),
+	)
+	for i, item := range matched {
+		if i >= testResultLimit {
+			text = text.Append(msgfmt.Plain(fmt.Sprintf("\n...其余 %d 条未显示", len(matched)-testResultLimit)))
+			break
+		}
+		text = text.Append(msgfmt.Plain(fmt.Sprintf("\n%d. ", i+1)), msgfmt.Link(item.Title, item.Link))
+	}
+
+	msg := newFormattedMessage(chatId, text)
+	msg.DisableWebPagePreview = true
+	return &msg, nil
+}
+
 func handleDelete(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error) {
 	if len(args) == 0 || len(args) == 1 {
 		return nil, errors.New("请选择你要删除的关键字")
@@ -689,8 +883,25 @@ func handleDelete(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, er
 		}
 	}
 
+	var disabled []string
+	for _, v := range exists.DisabledKeywordsArray {
+		if _, ok := deletes[v]; !ok {
+			disabled = append(disabled, v)
+		}
+	}
+
+	var legacy []string
+	for _, v := range exists.LegacyKeywordsArray {
+		if _, ok := deletes[v]; !ok {
+			legacy = append(legacy, v)
+		}
+	}
+
 	exists.KeywordsArray = newWords
+	exists.DisabledKeywordsArray = disabled
+	exists.LegacyKeywordsArray = legacy
 	db.AddSubscribeConfig(exists)
+	MatcherRegistryInstance().Reload(sub.ChatId, feedId)
 	return nil, nil
 }
 
@@ -719,6 +930,293 @@ func handleHelp(sub *db.Subscribe, _ []string) (*tgbotapi.MessageConfig, error)
 	return &msg, nil
 }
 
+// handleMode 查看或设置推送方式, /mode instant|hourly|daily [HH:MM]
+func handleMode(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error) {
+	digestTime := sub.DigestTime
+	if digestTime == "" {
+		digestTime = db.DefaultDigestTime
+	}
+
+	var text string
+	if len(args) == 0 {
+		text = fmt.Sprintf("当前推送方式: %s\n\n摘要模式下命中的帖子会汇总为一条消息推送, 每日摘要可以指定时间, 例如: /mode daily 21:30",
+			deliveryModeText(deliveryMode(sub), digestTime))
+	} else {
+		mode := strings.ToLower(args[0])
+		switch mode {
+		case db.DeliveryInstant, db.DeliveryHourly, db.DeliveryDaily:
+		default:
+			return nil, errors.New("推送方式只支持 instant(实时)、hourly(每小时)、daily(每天), 例如: /mode daily 21:30")
+		}
+		if len(args) > 1 {
+			hour, minute, err := parseClockTime(args[1])
+			if err != nil {
+				return nil, err
+			}
+			digestTime = fmt.Sprintf("%02d:%02d", hour, minute)
+		}
+		if err := db.UpdateSubscribeDelivery(sub.ChatId, mode, digestTime); err != nil {
+			return nil, err
+		}
+		sub.DeliveryMode, sub.DigestTime = mode, digestTime
+		text = "推送方式已设置为: " + deliveryModeText(mode, digestTime)
+		if mode == db.DeliveryInstant {
+			text += "\n未推送的摘要会在1分钟内发送"
+		}
+	}
+
+	buttons := make([]tgbotapi.InlineKeyboardButton, 0, 3)
+	for _, mode := range []string{db.DeliveryInstant, db.DeliveryHourly, db.DeliveryDaily} {
+		label := deliveryModeText(mode, digestTime)
+		if mode == deliveryMode(sub) {
+			label = "✅ " + label
+		}
+		event := vars.CallbackEvent[vars.CallbackMode]{Data: vars.CallbackMode{Mode: mode}}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(label, event.Param()))
+	}
+	msg := tgbotapi.NewMessage(sub.ChatId, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(buttons[0], buttons[1]),
+		tgbotapi.NewInlineKeyboardRow(buttons[2]),
+	)
+	return &msg, nil
+}
+
+// handleTz 查看或设置时区, /tz Asia/Shanghai
+func handleTz(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error) {
+	var text string
+	if len(args) == 0 {
+		loc := subscriberLocation(sub)
+		text = fmt.Sprintf("当前时区: %s, 当地时间 %s\n\n设置时区, 例如: /tz Asia/Tokyo 或 /tz UTC+8",
+			loc.String(), time.Now().In(loc).Format("2006-01-02 15:04"))
+	} else {
+		timezone, err := parseTimezone(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := db.UpdateSubscribeTimezone(sub.ChatId, timezone); err != nil {
+			return nil, err
+		}
+		sub.Timezone = timezone
+		loc := subscriberLocation(sub)
+		text = fmt.Sprintf("时区已设置为: %s, 当地时间 %s", timezone, time.Now().In(loc).Format("2006-01-02 15:04"))
+	}
+	msg := tgbotapi.NewMessage(sub.ChatId, text)
+	return &msg, nil
+}
+
+// handleQuiet 查看或设置免打扰时段, /quiet 23:00-08:00 [hold|silent], /quiet off 关闭
+func handleQuiet(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error) {
+	var text string
+	switch {
+	case len(args) == 0:
+		text = fmt.Sprintf("免打扰时段: %s\n时区: %s\n\n设置免打扰, 例如: /quiet 23:00-08:00 hold, hold 暂存到结束后汇总推送, silent 照常推送但不提醒, 关闭: /quiet off",
+			quietHoursText(sub), subscriberLocation(sub).String())
+	case strings.EqualFold(args[0], "off"):
+		if err := db.UpdateSubscribeQuiet(sub.ChatId, "", "", db.QuietHold); err != nil {
+			return nil, err
+		}
+		sub.QuietStart, sub.QuietEnd, sub.QuietMode = "", "", db.QuietHold
+		text = "免打扰已关闭, 暂存的消息会在1分钟内发送"
+	default:
+		start, end, err := parseQuietHours(args[0])
+		if err != nil {
+			return nil, err
+		}
+		mode := db.QuietHold
+		if len(args) > 1 {
+			mode = strings.ToLower(args[1])
+			if mode != db.QuietHold && mode != db.QuietSilent {
+				return nil, errors.New("免打扰方式只支持 hold(暂存后汇总推送)、silent(静默推送), 例如: /quiet 23:00-08:00 silent")
+			}
+		}
+		if err := db.UpdateSubscribeQuiet(sub.ChatId, start, end, mode); err != nil {
+			return nil, err
+		}
+		sub.QuietStart, sub.QuietEnd, sub.QuietMode = start, end, mode
+		text = fmt.Sprintf("免打扰已设置为: %s\n时区: %s", quietHoursText(sub), subscriberLocation(sub).String())
+	}
+	msg := tgbotapi.NewMessage(sub.ChatId, text)
+	return &msg, nil
+}
+
+// handleTarget 管理 Telegram 之外的推送目标
+// /target 查看, /target add 类型 地址, /target del|on|off|test id, /target on|off tg 启用或停用 Telegram
+func handleTarget(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error) {
+	if len(args) == 0 {
+		var sb strings.Builder
+		sb.WriteString(notifyTargetsText(sub, db.ListNotifyTargets(sub.ChatId, false)))
+		sb.WriteString("\n添加: /target add 类型 地址, 支持的类型和地址:\n")
+		for _, k := range targetKinds {
+			sb.WriteString(fmt.Sprintf("%s %s\n", k.kind, k.example))
+		}
+		sb.WriteString("\n删除: /target del id\n停用/启用: /target off id, /target on id\n停用/启用 Telegram: /target off tg, /target on tg\n发送测试消息: /target test id")
+		msg := tgbotapi.NewMessage(sub.ChatId, sb.String())
+		return &msg, nil
+	}
+
+	action := strings.ToLower(args[0])
+	if action == "add" {
+		if len(args) < 3 {
+			return nil, errors.New("格式错误, 例如: /target add ntfy https://ntfy.sh/your_topic")
+		}
+		target, err := addNotifyTarget(sub.ChatId, args[1], args[2])
+		if err != nil {
+			return nil, err
+		}
+		msg := tgbotapi.NewMessage(sub.ChatId, fmt.Sprintf("已添加推送目标 %d. %s %s, 可以发送 /target test %d 测试",
+			target.ID, target.Kind, maskTargetUrl(target.Url), target.ID))
+		return &msg, nil
+	}
+
+	if len(args) < 2 {
+		return nil, fmt.Errorf("格式错误, 例如: /target %s 1", action)
+	}
+	// tg 表示 Telegram, 只能启用或停用
+	if strings.EqualFold(args[1], "tg") {
+		if action != "on" && action != "off" {
+			return nil, errors.New("Telegram 只支持 /target on tg、/target off tg")
+		}
+		if err := db.UpdateSubscribeTelegramOff(sub.ChatId, action == "off"); err != nil {
+			return nil, err
+		}
+		text := "已恢复推送到 Telegram"
+		if action == "off" {
+			text = "命中的帖子不再推送到 Telegram, 只推送到其它启用的目标, 没有启用的其它目标时仍推送到 Telegram"
+		}
+		msg := tgbotapi.NewMessage(sub.ChatId, text)
+		return &msg, nil
+	}
+	id, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return nil, errors.New("推送目标 id 无效, 发送 /target 查看")
+	}
+
+	var text string
+	switch action {
+	case "del":
+		n, err := db.DeleteNotifyTarget(sub.ChatId, uint(id))
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errTargetUnavailable
+		}
+		text = "推送目标已删除"
+	case "on", "off":
+		n, err := db.SetNotifyTargetEnabled(sub.ChatId, uint(id), action == "on")
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, errTargetUnavailable
+		}
+		text = "推送目标已启用"
+		if action == "off" {
+			text = "推送目标已停用"
+		}
+	case "test":
+		target := db.GetNotifyTarget(uint(id))
+		if target == nil || target.ChatId != sub.ChatId {
+			return nil, errTargetUnavailable
+		}
+		notifier, err := newTargetNotifier(*target)
+		if err != nil {
+			return nil, err
+		}
+		// 推送目标可能要等到超时才返回, 在后台发送, 避免阻塞其他用户的命令
+		chatId := sub.ChatId
+		threading.GoSafe(func() {
+			result := "测试消息已发送"
+			err := notifier.Notify(NotifyMessage{
+				Text:   "📢  *测试消息*\n\n推送目标配置成功",
+				ChatId: &chatId,
+				Title:  "测试消息",
+			})
+			if err != nil {
+				result = fmt.Sprintf("测试消息发送失败: %v", err)
+			}
+			msg := tgbotapi.NewMessage(chatId, result)
+			sendMessage(&msg)
+		})
+		text = "正在发送测试消息, 结果稍后通知"
+	default:
+		return nil, errors.New("不支持的操作, 发送 /target 查看用法")
+	}
+	msg := tgbotapi.NewMessage(sub.ChatId, text)
+	return &msg, nil
+}
+
+// templateHelp /template 的说明
+const templateHelp = `设置: /template set 模板
+预览: /template preview [模板]
+恢复默认: /template reset
+
+模板使用 Go text/template 语法, 可以用 *文字* 加粗, [文字](链接) 插入链接, 可用变量:
+{{.Title}} 标题
+{{.TitleHighlight}} 标题, 命中关键字的部分加粗
+{{.Link}} 链接
+{{.Description}} 正文描述
+{{.Author}} 作者
+{{.Categories}} 分类
+{{.FeedName}} RSS源名称
+{{.Keyword}} 命中的关键字
+{{.Time}} 发布时间(当前时区)
+{{.Published.Format "01-02 15:04"}} 自定义时间格式
+{{truncate 30 .Title}} 截断到30个字`
+
+// handleTemplate 查看、预览或设置消息模板
+func handleTemplate(sub *db.Subscribe, args []string) (*tgbotapi.MessageConfig, error) {
+	action := ""
+	if len(args) > 0 {
+		action = strings.ToLower(args[0])
+	}
+	text := strings.TrimSpace(strings.Join(args[min(len(args), 1):], " "))
+
+	switch action {
+	case "":
+		current := "使用RSS源的默认模板"
+		if sub.Template != "" {
+			current = sub.Template
+		}
+		msg := tgbotapi.NewMessage(sub.ChatId, fmt.Sprintf("当前模板:\n%s\n\n%s", current, templateHelp))
+		return &msg, nil
+	case "set":
+		if err := ValidateMessageTemplate(text); err != nil {
+			return nil, err
+		}
+		if err := db.UpdateSubscribeTemplate(sub.ChatId, text); err != nil {
+			return nil, err
+		}
+		sub.Template = text
+		return templatePreview(sub, "模板已设置, 预览:", text), nil
+	case "preview":
+		if text == "" {
+			text = messageTemplate(sub, "")
+		}
+		if err := ValidateMessageTemplate(text); err != nil {
+			return nil, err
+		}
+		return templatePreview(sub, "预览:", text), nil
+	case "reset":
+		if err := db.UpdateSubscribeTemplate(sub.ChatId, ""); err != nil {
+			return nil, err
+		}
+		sub.Template = ""
+		msg := tgbotapi.NewMessage(sub.ChatId, "已恢复默认模板")
+		return &msg, nil
+	}
+	return nil, errors.New("不支持的操作, 发送 /template 查看用法")
+}
+
+// templatePreview 使用示例帖子生成预览, 与推送时相同按 MarkdownV2 发送
+func templatePreview(sub *db.Subscribe, title, tmpl string) *tgbotapi.MessageConfig {
+	text := formatMessage(tmpl, sampleMessageData(subscriberLocation(sub)))
+	msg := tgbotapi.NewMessage(sub.ChatId, msgfmt.Text(title+"\n\n").Append(msgfmt.Parse(text)...).MarkdownV2())
+	msg.ParseMode = tgbotapi.ModeMarkdownV2
+	return &msg
+}
+
 func handleOn(sub *db.Subscribe, _ []string) (*tgbotapi.MessageConfig, error) {
 	sub.Status = "on"
 	db.UpdateSubscribe(sub)
@@ -745,10 +1243,56 @@ func handleStatus(sub *db.Subscribe) {
 		ip = "未知"
 	}
 
-	message := fmt.Sprintf("当前状态: \n订阅数: %d \n当天发送: %d \n当前IP: %s",
-		len(subscribers), todaySend, ip)
+	counts := subscriberCounts(subscribers)
+	message := fmt.Sprintf("当前状态: \n订阅数: %d \n开启通知: %d \n屏蔽机器人: %d \n移出群组/频道: %d \n当天发送: %d \n待发送: %d \n当前IP: %s",
+		len(subscribers), counts["on"], counts[db.SubscribeStatusBlocked], counts[db.SubscribeStatusKicked],
+		todaySend, db.CountPendingOutbox(), ip)
+	if health := feedHealthText(); health != "" {
+		message += "\n\nRSS源状态:\n" + health
+	}
 	msg := tgbotapi.NewMessage(sub.ChatId, message)
-	msg.ParseMode = tgbotapi.ModeHTML
+	sendMessage(&msg)
+}
+
+// notifyRuleDisabled 通知用户正则关键字因多次匹配超时被停用
+func notifyRuleDisabled(chatId int64, feedId string, keyword string) {
+	if tgBot == nil {
+		return
+	}
+	text := msgfmt.New(
+		msgfmt.Plain(fmt.Sprintf("⚠️ 您在 %s 添加的关键字 ", feedId)), msgfmt.Code(keyword),
+		msgfmt.Plain(" 多次匹配超时, 已被自动停用。\n请简化正则后使用 /add 重新添加, 或在 /feed 中删除该关键字。"),
+	)
+	msg := newFormattedMessage(chatId, text)
+	sendMessage(&msg)
+}
+
+// notifyLegacyKeywords 通知订阅者已保存的关键字按新语法无法解析或含义不同, 未发送时返回 false
+func notifyLegacyKeywords(chatId int64, feedId string, keywords, reasons []string) bool {
+	if tgBot == nil {
+		return false
+	}
+	text := msgfmt.Text(fmt.Sprintf("⚠️ 关键字语法已升级, 您在 %s 添加的以下关键字按新语法无法解析或含义不同, 仍按原来的方式匹配:", feedId))
+	for i, keyword := range keywords {
+		text = text.Append(msgfmt.Plain("\n"), msgfmt.Code(keyword), msgfmt.Plain("\n    "+reasons[i]))
+	}
+	text = text.Append(msgfmt.Plain("\n\n新语法支持 AND OR NOT 组合, 发送 /help 查看说明, 使用 /add 重新添加同样的关键字后改为按新语法匹配。"))
+	msg := newFormattedMessage(chatId, text)
+	sendMessage(&msg)
+	return true
+}
+
+// notifyFeedRemoved 通知订阅者 feed 已被删除, 附上被移除的关键字方便重新添加
+func notifyFeedRemoved(chatId int64, feed db.FeedConfig, keywords []string) {
+	if tgBot == nil {
+		return
+	}
+	text := msgfmt.Text(fmt.Sprintf("⚠️ RSS源 %s(%s) 已下线, 您在该源添加的关键字已被移除:", feed.Name, feed.FeedId))
+	for _, keyword := range keywords {
+		text = text.Append(msgfmt.Plain("\n"), msgfmt.Code(keyword))
+	}
+	text = text.Append(msgfmt.Plain("\n\n可以使用 /feed 查看其他RSS源。"))
+	msg := newFormattedMessage(chatId, text)
 	sendMessage(&msg)
 }
 
@@ -765,28 +1309,3 @@ func getPublicIP() string {
 func TgBotInstance() *tgbotapi.BotAPI {
 	return tgBot
 }
-
-// escapeMarkdown 转义Markdown特殊字符
-func escapeMarkdown(text string) string {
-	replacer := strings.NewReplacer(
-		"_", "\\_",
-		"*", "\\*",
-		"[", "\\[",
-		"]", "\\]",
-		"(", "\\(",
-		")", "\\)",
-		"~", "\\~",
-		"`", "\\`",
-		">", "\\>",
-		"#", "\\#",
-		"+", "\\+",
-		"-", "\\-",
-		"=", "\\=",
-		"|", "\\|",
-		"{", "\\{",
-		"}", "\\}",
-		".", "\\.",
-		"!", "\\!",
-	)
-	return replacer.Replace(text)
-}
@@ -0,0 +1,324 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	json "github.com/bytedance/sonic"
+	"github.com/zeromicro/go-zero/core/logx"
+	"github.com/zeromicro/go-zero/core/rescue"
+)
+
+const (
+	webhookPollInterval = time.Second
+	webhookBatchSize    = 20
+	webhookTimeout      = 15 * time.Second
+	webhookRetention    = 30 * 24 * time.Hour // 投递记录的保留时长
+	webhookUserAgent    = "ns-feed-bot"
+)
+
+// webhook 投递结果
+const (
+	webhookSucceeded = "succeeded"
+	webhookRetried   = "retried"
+	webhookFailed    = "failed"
+)
+
+// webhookHTTPClient webhook 由管理员注册, 允许推送到内网地址
+var webhookHTTPClient = &http.Client{Timeout: webhookTimeout}
+
+var webhookRegistry *WebhookRegistry
+
+func init() {
+	webhookRegistry = NewWebhookRegistry()
+}
+
+func WebhookRegistryInstance() *WebhookRegistry {
+	return webhookRegistry
+}
+
+// webhookMatcher 单个 webhook 已编译的关键字规则, 与订阅者使用相同的匹配器
+type webhookMatcher struct {
+	webhook *db.Webhook
+	matcher *subscriptionMatcher
+}
+
+func newWebhookMatcher(w *db.Webhook) *webhookMatcher {
+	matcher := newSubscriptionMatcher(db.SubscribeConfig{FeedId: w.FeedId, KeywordsArray: w.KeywordsArray})
+	for _, rule := range matcher.rules {
+		rule.webhookId = w.ID
+	}
+	return &webhookMatcher{webhook: w, matcher: matcher}
+}
+
+// onWebhookRuleDisabled webhook 的正则规则多次匹配超时后的处理, 测试中可替换
+var onWebhookRuleDisabled = disableTimedOutWebhook
+
+// disableTimedOutWebhook 停用规则所属的 webhook, 管理员修改关键字后重新启用
+func disableTimedOutWebhook(webhookId uint, keyword string) {
+	logx.Errorw("disable webhook after keyword regex timeouts", logx.Field("webhookId", webhookId), logx.Field("keyword", keyword))
+	if err := db.DisableWebhook(webhookId, db.WebhookDisabledRegexTimeout); err != nil {
+		logx.Errorw("disable webhook failed", logx.Field("err", err), logx.Field("webhookId", webhookId))
+	}
+	WebhookRegistryInstance().Invalidate()
+}
+
+// WebhookRegistry 按 feed 缓存启用的 webhook 及其匹配器, webhook 变更时需调用 Invalidate
+type WebhookRegistry struct {
+	mu    sync.RWMutex
+	feeds map[string][]*webhookMatcher
+}
+
+func NewWebhookRegistry() *WebhookRegistry {
+	return &WebhookRegistry{feeds: make(map[string][]*webhookMatcher)}
+}
+
+// Feed 返回 feed 启用的 webhook, 首次访问时从数据库加载
+func (r *WebhookRegistry) Feed(feedId string) []*webhookMatcher {
+	r.mu.RLock()
+	matchers, ok := r.feeds[feedId]
+	r.mu.RUnlock()
+	if ok {
+		return matchers
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if matchers, ok = r.feeds[feedId]; ok {
+		return matchers
+	}
+	for _, w := range db.ListEnabledWebhooksWithFeedId(feedId) {
+		matchers = append(matchers, newWebhookMatcher(w))
+	}
+	r.feeds[feedId] = matchers
+	return matchers
+}
+
+// Invalidate 清除所有缓存
+func (r *WebhookRegistry) Invalidate() {
+	r.mu.Lock()
+	r.feeds = make(map[string][]*webhookMatcher)
+	r.mu.Unlock()
+}
+
+// ValidateWebhook 校验 webhook 的 feed、地址和关键字
+func ValidateWebhook(w *db.Webhook) error {
+	if feed := db.GetFeedConfigWithFeedId(w.FeedId); feed.ID == 0 {
+		return errors.New("未找到该feed")
+	}
+	u, err := url.Parse(w.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url 需要是 http 或 https 链接")
+	}
+	if len(w.KeywordsArray) == 0 {
+		return errors.New("keyword 不能为空")
+	}
+	return validateKeywords(w.KeywordsArray)
+}
+
+// NewWebhookSecret 生成随机的签名密钥
+func NewWebhookSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// signWebhook 计算请求体的 HMAC-SHA256 签名
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookPayload 推送给 webhook 的 JSON
+type webhookPayload struct {
+	WebhookId uint   `json:"webhookId"`
+	FeedId    string `json:"feedId"`
+	FeedName  string `json:"feedName"`
+	Title     string `json:"title"`
+	Link      string `json:"link"`
+	Published string `json:"published"` // RFC3339 格式, 帖子没有发布时间时为空
+	Rule      string `json:"rule"`      // 命中的关键字
+}
+
+// matchWebhooks 计算每个 webhook 命中的条目, 生成待投递的记录
+func matchWebhooks(feed *db.FeedConfig, matchers []*webhookMatcher, entries []*feedEntry) []*db.WebhookDelivery {
+	var deliveries []*db.WebhookDelivery
+	for _, m := range matchers {
+		for _, entry := range entries {
+			match, ok := m.matcher.matchRule(entry.doc)
+			if !ok {
+				continue
+			}
+			link, err := removeHash(entry.item.Link)
+			if err != nil || link == "" {
+				continue
+			}
+			payload := webhookPayload{
+				WebhookId: m.webhook.ID,
+				FeedId:    feed.FeedId,
+				FeedName:  feed.Name,
+				Title:     entry.item.Title,
+				Link:      link,
+				Rule:      match.Rule,
+			}
+			if entry.item.PublishedParsed != nil {
+				payload.Published = entry.item.PublishedParsed.Format(time.RFC3339)
+			}
+			body, err := json.Marshal(payload)
+			if err != nil {
+				continue
+			}
+			deliveries = append(deliveries, &db.WebhookDelivery{
+				WebhookId: m.webhook.ID,
+				Link:      link,
+				Title:     entry.item.Title,
+				Rule:      match.Rule,
+				Payload:   string(body),
+			})
+		}
+	}
+	return deliveries
+}
+
+// dispatchWebhooks 将命中关键字的条目写入投递队列, 已投递过的帖子不会重复投递
+func (f *NsFeed) dispatchWebhooks(feed *db.FeedConfig, entries []*feedEntry) {
+	matchers := WebhookRegistryInstance().Feed(feed.FeedId)
+	if len(matchers) == 0 {
+		return
+	}
+	deliveries := matchWebhooks(feed, matchers, entries)
+	n, err := db.AddWebhookDeliveries(deliveries)
+	if err != nil {
+		f.logger.Errorw("add webhook deliveries failed", logx.Field("err", err), logx.Field("feedId", feed.FeedId))
+		return
+	}
+	if n > 0 {
+		f.logger.Infow("webhook deliveries enqueued", logx.Field("count", n), logx.Field("feedId", feed.FeedId))
+		f.wakeWebhooks()
+	}
+}
+
+// wakeWebhooks 通知投递协程有新记录
+func (f *NsFeed) wakeWebhooks() {
+	select {
+	case f.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// startWebhookConsumer 投递 webhook, 启动时继续投递上次未完成的记录
+func (f *NsFeed) startWebhookConsumer() {
+	defer rescue.Recover()
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		f.drainWebhooks()
+		select {
+		case <-f.ctx.Done():
+			return
+		case <-f.webhookWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// drainWebhooks 投递所有已到时间的记录
+func (f *NsFeed) drainWebhooks() {
+	for {
+		deliveries := db.ListPendingWebhookDeliveries(webhookBatchSize)
+		if len(deliveries) == 0 {
+			return
+		}
+		webhooks := make(map[uint]*db.Webhook)
+		for _, d := range deliveries {
+			if f.ctx.Err() != nil {
+				return
+			}
+			w, ok := webhooks[d.WebhookId]
+			if !ok {
+				w = db.GetWebhook(d.WebhookId)
+				webhooks[d.WebhookId] = w
+			}
+			// 状态无法更新时停止本轮投递, 避免重复投递
+			if err := f.deliverWebhook(w, d); err != nil {
+				f.logger.Errorw("update webhook delivery failed", logx.Field("err", err), logx.Field("id", d.ID))
+				return
+			}
+		}
+	}
+}
+
+// deliverWebhook 投递一条记录并更新状态, 返回更新状态的错误
+func (f *NsFeed) deliverWebhook(w *db.Webhook, d *db.WebhookDelivery) error {
+	if w == nil || !w.Enabled {
+		webhookDeliveriesTotal.WithLabelValues(webhookFailed).Inc()
+		return db.FailWebhookDelivery(d.ID, 0, "webhook 不存在或已停用")
+	}
+
+	status, err := postWebhook(w, d)
+	if err == nil {
+		webhookDeliveriesTotal.WithLabelValues(webhookSucceeded).Inc()
+		return db.MarkWebhookDelivered(d.ID, status)
+	}
+
+	kind := classifySendError(err)
+	f.logger.Errorw("deliver webhook failed", logx.Field("err", err), logx.Field("kind", kind.String()),
+		logx.Field("id", d.ID), logx.Field("webhookId", w.ID), logx.Field("attempts", d.Attempts+1))
+	if kind == sendRetryable && d.Attempts+1 < maxSendAttempts {
+		webhookDeliveriesTotal.WithLabelValues(webhookRetried).Inc()
+		return db.RetryWebhookDelivery(d.ID, time.Now().Add(retryBackoff(d.Attempts+1)), status, err.Error())
+	}
+	webhookDeliveriesTotal.WithLabelValues(webhookFailed).Inc()
+	return db.FailWebhookDelivery(d.ID, status, err.Error())
+}
+
+// postWebhook 发送投递记录, 返回 http 状态码, 非 2xx 时返回 notifyStatusError
+func postWebhook(w *db.Webhook, d *db.WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, w.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", webhookUserAgent)
+	req.Header.Set("X-Signature", signWebhook(w.Secret, body))
+	req.Header.Set("X-Webhook-Id", strconv.FormatUint(uint64(w.ID), 10))
+	req.Header.Set("X-Delivery-Id", strconv.FormatUint(uint64(d.ID), 10))
+
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxTargetErrorBodyLength))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &notifyStatusError{Kind: "webhook", Status: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	return resp.StatusCode, nil
+}
+
+// cleanupWebhookDeliveries 删除过期的投递记录
+func (f *NsFeed) cleanupWebhookDeliveries() {
+	n, err := db.DeleteWebhookDeliveriesBefore(time.Now().Add(-webhookRetention))
+	if err != nil {
+		f.logger.Errorw("delete webhook deliveries failed", logx.Field("err", err))
+	} else if n > 0 {
+		f.logger.Infow("delete webhook deliveries", logx.Field("count", n))
+	}
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ns-rss/src/app/db"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_matchWebhooks(t *testing.T) {
+	published := time.Date(2024, 5, 1, 1, 0, 0, 0, time.UTC)
+	entries := newFeedEntries([]*gofeed.Item{
+		{Title: "出 港仔 年付", Link: "https://www.nodeseek.com/post-1#reply", PublishedParsed: &published},
+		{Title: "收 港仔", Link: "https://www.nodeseek.com/post-2"},
+		{Title: "出 boil", Link: "https://www.nodeseek.com/post-3"},
+	})
+	feed := &db.FeedConfig{FeedId: "ns", Name: "NodeSeek"}
+	matchers := []*webhookMatcher{
+		newWebhookMatcher(&db.Webhook{ID: 1, FeedId: "ns", KeywordsArray: []string{"港仔 NOT 收", "boil"}}),
+		newWebhookMatcher(&db.Webhook{ID: 2, FeedId: "ns", KeywordsArray: []string{"年付"}}),
+	}
+
+	deliveries := matchWebhooks(feed, matchers, entries)
+	if !assert.Len(t, deliveries, 3) {
+		return
+	}
+	assert.Equal(t, uint(1), deliveries[0].WebhookId)
+	assert.Equal(t, "港仔 NOT 收", deliveries[0].Rule)
+	assert.Equal(t, "https://www.nodeseek.com/post-1", deliveries[0].Link)
+	assert.Equal(t, "boil", deliveries[1].Rule)
+	assert.Equal(t, uint(2), deliveries[2].WebhookId)
+
+	var payload webhookPayload
+	assert.NoError(t, json.Unmarshal([]byte(deliveries[0].Payload), &payload))
+	assert.Equal(t, "ns", payload.FeedId)
+	assert.Equal(t, "出 港仔 年付", payload.Title)
+	assert.Equal(t, "https://www.nodeseek.com/post-1", payload.Link)
+	assert.Equal(t, "2024-05-01T01:00:00Z", payload.Published)
+	assert.Equal(t, "港仔 NOT 收", payload.Rule)
+}
+
+func Test_postWebhook(t *testing.T) {
+	status := http.StatusOK
+	var signature, deliveryId string
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Signature")
+		deliveryId = r.Header.Get("X-Delivery-Id")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	w := &db.Webhook{ID: 1, Url: srv.URL, Secret: "secret"}
+	d := &db.WebhookDelivery{ID: 7, WebhookId: 1, Payload: `{"title":"出 港仔"}`}
+	code, err := postWebhook(w, d)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, d.Payload, string(body))
+	assert.Equal(t, "7", deliveryId)
+
+	// 接收方使用相同的密钥校验签名
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), signature)
+
+	status = http.StatusServiceUnavailable
+	code, err = postWebhook(w, d)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, sendRetryable, classifySendError(err))
+
+	status = http.StatusGone
+	_, err = postWebhook(w, d)
+	assert.Equal(t, sendPermanent, classifySendError(err))
+}
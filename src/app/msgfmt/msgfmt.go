@@ -0,0 +1,270 @@
+// Package msgfmt 使用类型化的片段(普通文本、加粗、代码、链接)构造消息,
+// 并按 Telegram 的 HTML / MarkdownV2 规则转义输出, 避免标题中的 * [ 等字符破坏格式.
+//
+// 消息在 outbox 等处以一种简单的标记格式保存(见 Message.String 和 Parse):
+//
+//	*加粗*  `代码`  [文字](链接)  \* 转义
+package msgfmt
+
+import (
+	"html"
+	"strings"
+)
+
+// Kind 片段类型
+type Kind int
+
+const (
+	KindPlain Kind = iota
+	KindBold
+	KindCode
+	KindLink
+)
+
+// 与 Telegram parse_mode 取值一致
+const (
+	ModeHTML       = "HTML"
+	ModeMarkdownV2 = "MarkdownV2"
+)
+
+// Segment 消息中的一段文本
+type Segment struct {
+	Kind Kind
+	Text string
+	// Url 仅 KindLink 使用
+	Url string
+}
+
+// Message 由若干片段组成的消息
+type Message []Segment
+
+func Plain(text string) Segment {
+	return Segment{Kind: KindPlain, Text: text}
+}
+
+func Bold(text string) Segment {
+	return Segment{Kind: KindBold, Text: text}
+}
+
+func Code(text string) Segment {
+	return Segment{Kind: KindCode, Text: text}
+}
+
+// Link 链接, text 为空时显示链接本身
+func Link(text, url string) Segment {
+	if text == "" {
+		text = url
+	}
+	return Segment{Kind: KindLink, Text: text, Url: url}
+}
+
+// New 由片段构造消息
+func New(segments ...Segment) Message {
+	return Message(segments)
+}
+
+// Text 纯文本消息
+func Text(text string) Message {
+	return Message{Plain(text)}
+}
+
+// Append 追加片段
+func (m Message) Append(segments ...Segment) Message {
+	return append(m, segments...)
+}
+
+// Render 按 Telegram parse_mode 输出
+func (m Message) Render(mode string) string {
+	switch mode {
+	case ModeHTML:
+		return m.HTML()
+	case ModeMarkdownV2:
+		return m.MarkdownV2()
+	default:
+		return m.Plain()
+	}
+}
+
+// HTML 输出 Telegram HTML 格式
+func (m Message) HTML() string {
+	var sb strings.Builder
+	for _, seg := range m {
+		text := html.EscapeString(seg.Text)
+		switch seg.Kind {
+		case KindBold:
+			sb.WriteString("<b>" + text + "</b>")
+		case KindCode:
+			sb.WriteString("<code>" + text + "</code>")
+		case KindLink:
+			sb.WriteString(`<a href="` + html.EscapeString(seg.Url) + `">` + text + "</a>")
+		default:
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+// markdownV2Text 普通文本中需要转义的字符
+var markdownV2Text = strings.NewReplacer(
+	"\\", "\\\\",
+	"_", "\\_", "*", "\\*", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)",
+	"~", "\\~", "`", "\\`", ">", "\\>", "#", "\\#", "+", "\\+", "-", "\\-",
+	"=", "\\=", "|", "\\|", "{", "\\{", "}", "\\}", ".", "\\.", "!", "\\!",
+)
+
+// markdownV2Code 代码中只需转义 ` 和 \
+var markdownV2Code = strings.NewReplacer("\\", "\\\\", "`", "\\`")
+
+// markdownV2Url 链接地址中只需转义 ) 和 \
+var markdownV2Url = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+// MarkdownV2 输出 Telegram MarkdownV2 格式
+func (m Message) MarkdownV2() string {
+	var sb strings.Builder
+	for _, seg := range m {
+		switch seg.Kind {
+		case KindBold:
+			sb.WriteString("*" + markdownV2Text.Replace(seg.Text) + "*")
+		case KindCode:
+			sb.WriteString("`" + markdownV2Code.Replace(seg.Text) + "`")
+		case KindLink:
+			sb.WriteString("[" + markdownV2Text.Replace(seg.Text) + "](" + markdownV2Url.Replace(seg.Url) + ")")
+		default:
+			sb.WriteString(markdownV2Text.Replace(seg.Text))
+		}
+	}
+	return sb.String()
+}
+
+// slackText Slack mrkdwn 中需要转义的字符
+var slackText = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Slack 输出 Slack mrkdwn 格式, mrkdwn 无法转义 *, 加粗文字中的 * 替换为 ∗
+func (m Message) Slack() string {
+	var sb strings.Builder
+	for _, seg := range m {
+		text := slackText.Replace(seg.Text)
+		switch seg.Kind {
+		case KindBold:
+			sb.WriteString("*" + strings.ReplaceAll(text, "*", "∗") + "*")
+		case KindCode:
+			sb.WriteString("`" + text + "`")
+		case KindLink:
+			sb.WriteString("<" + slackText.Replace(seg.Url) + "|" + strings.ReplaceAll(text, "|", "¦") + ">")
+		default:
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+// Plain 输出纯文本, 链接文字与地址不同时追加地址
+func (m Message) Plain() string {
+	var sb strings.Builder
+	for _, seg := range m {
+		sb.WriteString(seg.Text)
+		if seg.Kind == KindLink && seg.Url != seg.Text {
+			sb.WriteString(" (" + seg.Url + ")")
+		}
+	}
+	return sb.String()
+}
+
+// markupText 标记格式中需要转义的字符, ) 会结束链接地址, 也一并转义
+var markupText = strings.NewReplacer("\\", "\\\\", "*", "\\*", "`", "\\`", "[", "\\[", "]", "\\]", ")", "\\)")
+
+// markupUrl 标记格式的链接地址中需要转义的字符
+var markupUrl = strings.NewReplacer("\\", "\\\\", ")", "\\)")
+
+// Escape 转义文本, 使其在标记格式中按原样显示
+func Escape(text string) string {
+	return markupText.Replace(text)
+}
+
+// String 序列化为标记格式, Parse(m.String()) 与 m 等价
+func (m Message) String() string {
+	var sb strings.Builder
+	for _, seg := range m {
+		switch seg.Kind {
+		case KindBold:
+			sb.WriteString("*" + markupText.Replace(seg.Text) + "*")
+		case KindCode:
+			sb.WriteString("`" + markupText.Replace(seg.Text) + "`")
+		case KindLink:
+			sb.WriteString("[" + markupText.Replace(seg.Text) + "](" + markupUrl.Replace(seg.Url) + ")")
+		default:
+			sb.WriteString(markupText.Replace(seg.Text))
+		}
+	}
+	return sb.String()
+}
+
+// Parse 解析标记格式, 未闭合的标记按普通字符处理, 不会返回错误
+func Parse(markup string) Message {
+	var m Message
+	var plain strings.Builder
+	flush := func() {
+		if plain.Len() > 0 {
+			m = append(m, Plain(plain.String()))
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(markup); {
+		c := markup[i]
+		switch c {
+		case '\\':
+			if i+1 < len(markup) {
+				plain.WriteByte(markup[i+1])
+				i += 2
+			} else {
+				plain.WriteByte(c)
+				i++
+			}
+			continue
+		case '*', '`':
+			if text, end, ok := scanUntil(markup, i+1, c); ok && text != "" {
+				flush()
+				if c == '*' {
+					m = append(m, Bold(text))
+				} else {
+					m = append(m, Code(text))
+				}
+				i = end + 1
+				continue
+			}
+		case '[':
+			if text, end, ok := scanUntil(markup, i+1, ']'); ok && end+1 < len(markup) && markup[end+1] == '(' {
+				if url, urlEnd, ok := scanUntil(markup, end+2, ')'); ok && url != "" {
+					flush()
+					m = append(m, Link(text, url))
+					i = urlEnd + 1
+					continue
+				}
+			}
+		}
+		plain.WriteByte(c)
+		i++
+	}
+	flush()
+	return m
+}
+
+// scanUntil 从 start 开始查找未转义的 delim, 返回去掉转义后的内容和 delim 的位置
+func scanUntil(s string, start int, delim byte) (string, int, bool) {
+	var sb strings.Builder
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			sb.WriteByte(s[i])
+		case delim:
+			return sb.String(), i, true
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", 0, false
+}
@@ -0,0 +1,107 @@
+package msgfmt
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "更新 testdata 中的 golden 文件")
+
+// render 将消息的各种输出拼成一个 golden 文件
+func render(m Message) string {
+	var sb strings.Builder
+	for _, out := range []struct{ name, text string }{
+		{"markdownv2", m.MarkdownV2()},
+		{"html", m.HTML()},
+		{"slack", m.Slack()},
+		{"plain", m.Plain()},
+		{"markup", m.String()},
+	} {
+		sb.WriteString("-- " + out.name + " --\n" + out.text + "\n")
+	}
+	return sb.String()
+}
+
+func TestMessage_Golden(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{
+			name: "plain_special",
+			msg:  Text("a_b*c[d]e(f)g~h`i>j#k+l-m=n|o{p}q.r!s\\t <&> \"'"),
+		},
+		{
+			name: "bold_title",
+			msg:  New(Plain("📢  "), Bold("C++ *重磅* [公告] v1.2!"), Plain("\n\n🕐 2024-01-02 03:04:05")),
+		},
+		{
+			name: "code",
+			msg:  New(Plain("关键词: "), Code("a`b\\c*d_e<f>")),
+		},
+		{
+			name: "link",
+			msg: New(
+				Link("标题 [1] & <x>", "https://example.com/a_(b)?q=1&r=\\"),
+				Plain("\n"),
+				Link("", "https://linux.do/t/topic/1"),
+			),
+		},
+		{
+			name: "notification",
+			msg: New(
+				Plain("📢  "), Bold("出 港仔 *急*"),
+				Plain("\n\n🕐 2024-01-02 03:04:05\n\n👉 "), Plain("https://www.nodeseek.com/post-1-1"),
+			),
+		},
+		{
+			name: "parse_markup",
+			msg:  Parse("📢  *加粗\\*标题*\n`code` [链接](https://a.com/\\)) \\[不是链接] 价格 2*3 未闭合`"),
+		},
+		{
+			name: "parse_legacy",
+			msg:  Parse("📢  *出 港仔*\n\n🕐 2024-01-02 03:04:05\n\n👉 https://www.nodeseek.com/post-1-1"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := render(tt.msg)
+			path := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				assert.NoError(t, os.WriteFile(path, []byte(got), 0o644))
+			}
+			want, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, string(want), got)
+		})
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	msgs := []Message{
+		New(Plain("a*b`c[d]e\\f"), Bold("x*y"), Code("`"), Link("[t]", "https://a.com/(1)")),
+		Text("末尾反斜杠\\"),
+		New(Bold("粗"), Plain(" "), Link("", "https://a.com")),
+	}
+	for _, m := range msgs {
+		assert.Equal(t, m, Parse(m.String()))
+	}
+}
+
+func TestParse_Lenient(t *testing.T) {
+	assert.Equal(t, Text("2*3"), Parse("2*3"))
+	assert.Equal(t, Text("**"), Parse("**"))
+	assert.Equal(t, Text("[a](b"), Parse("[a](b"))
+	assert.Equal(t, Text("[a] (b)"), Parse("[a] (b)"))
+	assert.Equal(t, Message(nil), Parse(""))
+}
+
+func TestEscape(t *testing.T) {
+	s := "*[x](y)* `z` \\"
+	assert.Equal(t, Text(s), Parse(Escape(s)))
+}
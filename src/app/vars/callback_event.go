@@ -15,6 +15,7 @@ const (
 	EventOn            Event = "6"
 	EventOff           Event = "7"
 	EventStatus        Event = "8"
+	EventMode          Event = "9"
 )
 
 type CallbackEvent[T CallbackData] struct {
@@ -98,3 +99,12 @@ type CallbackStatus struct {
 func (c CallbackStatus) Method() string {
 	return string(EventStatus)
 }
+
+// CallbackMode 切换推送方式
+type CallbackMode struct {
+	Mode string `json:"m"`
+}
+
+func (c CallbackMode) Method() string {
+	return string(EventMode)
+}
@@ -111,6 +111,11 @@ func main() {
 		}
 	}
 
+	// 命令行指定的抓取间隔作为默认的最小间隔
+	if config.FetchTimeInterval == "" {
+		config.FetchTimeInterval = fetchInterval.String()
+	}
+
 	// 验证必要参数
 	if *tgToken == "" {
 		log.Fatal("Telegram bot token is required")